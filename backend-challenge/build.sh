@@ -1,4 +1,5 @@
 #!/usr/bin/env bash
 set -e
 
-go build -o backend-challenge .
\ No newline at end of file
+go build -o backend-challenge .
+go build -o kartctl ./cmd/kartctl
\ No newline at end of file
@@ -0,0 +1,16 @@
+// Command kartctl runs the operational tasks of the service from the command line: sorting,
+// verifying and indexing coupon files, looking coupons up, validating the product catalog and
+// exporting orders. Run it without arguments for the list of commands.
+//
+//	go build -o kartctl ./cmd/kartctl
+package main
+
+import (
+	"os"
+
+	"github.com/dekanayake/kart-challenge/backend-challenge/internal/cli"
+)
+
+func main() {
+	os.Exit(cli.Run(os.Args[1:], os.Stdout, os.Stderr))
+}
@@ -0,0 +1,425 @@
+// Package bench measures the coupon readers over generated datasets: the index build time, the
+// latency of cold lookups, made with the coupon files evicted from the page cache where the OS
+// allows it, and of warm lookups, and the allocations per lookup. A run tries every combination of
+// reader, chunk size and search worker pool size, and its Report is written as JSON so that runs
+// can be compared with Compare.
+package bench
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"time"
+
+	"github.com/dekanayake/kart-challenge/backend-challenge/internal/btree"
+	"github.com/dekanayake/kart-challenge/backend-challenge/internal/dataset"
+	"github.com/dekanayake/kart-challenge/backend-challenge/internal/reader"
+	"github.com/dekanayake/kart-challenge/backend-challenge/internal/validset"
+)
+
+type Config struct {
+	// Dir holds the dataset. It is generated there with Dataset when it has no manifest, and in a
+	// temporary folder removed after the run when Dir is empty.
+	Dir     string
+	Dataset dataset.Options
+	Readers []string
+	// ChunkSizes are the lines per index entry of plain files, block-gzip files are indexed by block.
+	ChunkSizes       []int
+	Workers          []int
+	BuildConcurrency int
+	// Lookups is the number of warm lookups per case, ColdLookups the number of cold ones.
+	Lookups     int
+	ColdLookups int
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Dataset:          dataset.DefaultOptions(),
+		Readers:          []string{reader.HDDReader, reader.PrecomputedReader, reader.BTreeReader},
+		ChunkSizes:       []int{100, 1000, 10000},
+		Workers:          []int{1, 4},
+		BuildConcurrency: runtime.NumCPU(),
+		Lookups:          10000,
+		ColdLookups:      20,
+	}
+}
+
+func (c Config) Validate() error {
+	if len(c.Readers) == 0 || len(c.ChunkSizes) == 0 || len(c.Workers) == 0 {
+		return fmt.Errorf("readers, chunk sizes and workers must not be empty")
+	}
+	for _, r := range c.Readers {
+		if r != reader.HDDReader && r != reader.PrecomputedReader && r != reader.BTreeReader {
+			return fmt.Errorf("unsupported reader type: %s", r)
+		}
+	}
+	for _, n := range append(slices.Clone(c.ChunkSizes), c.Workers...) {
+		if n <= 0 {
+			return fmt.Errorf("chunk sizes and workers must be greater than 0, got %d", n)
+		}
+	}
+	if c.BuildConcurrency <= 0 || c.Lookups <= 0 || c.ColdLookups < 0 {
+		return fmt.Errorf("build concurrency and lookups must be greater than 0, cold lookups not negative")
+	}
+	return nil
+}
+
+// Latency summarizes lookup durations, in microseconds.
+type Latency struct {
+	Count  int     `json:"count"`
+	MeanUs float64 `json:"meanUs"`
+	P50Us  float64 `json:"p50Us"`
+	P90Us  float64 `json:"p90Us"`
+	P99Us  float64 `json:"p99Us"`
+	MaxUs  float64 `json:"maxUs"`
+}
+
+func newLatency(durations []time.Duration) Latency {
+	if len(durations) == 0 {
+		return Latency{}
+	}
+	sorted := slices.Clone(durations)
+	slices.Sort(sorted)
+	var total time.Duration
+	for _, d := range sorted {
+		total += d
+	}
+	// nearest rank
+	percentile := func(p float64) float64 {
+		rank := int(p*float64(len(sorted))+0.999999) - 1
+		return micros(sorted[min(max(rank, 0), len(sorted)-1)])
+	}
+	return Latency{
+		Count:  len(sorted),
+		MeanUs: micros(total / time.Duration(len(sorted))),
+		P50Us:  percentile(0.50),
+		P90Us:  percentile(0.90),
+		P99Us:  percentile(0.99),
+		MaxUs:  micros(sorted[len(sorted)-1]),
+	}
+}
+
+func micros(d time.Duration) float64 {
+	return float64(d.Nanoseconds()) / 1e3
+}
+
+type Result struct {
+	Reader       string  `json:"reader"`
+	ChunkSize    int     `json:"chunkSize"`
+	Workers      int     `json:"workers"`
+	IndexBuildMs float64 `json:"indexBuildMs"`
+	IndexEntries int     `json:"indexEntries"`
+	Cold         Latency `json:"cold"`
+	Warm         Latency `json:"warm"`
+	// AllocsPerLookup and BytesPerLookup are measured over the warm lookups.
+	AllocsPerLookup float64 `json:"allocsPerLookup"`
+	BytesPerLookup  float64 `json:"bytesPerLookup"`
+	// Wrong counts the lookups whose answer disagrees with the manifest.
+	Wrong  int `json:"wrong"`
+	Errors int `json:"errors"`
+}
+
+// Key identifies the case of the result across runs.
+func (r Result) Key() string {
+	return fmt.Sprintf("%s/chunk=%d/workers=%d", r.Reader, r.ChunkSize, r.Workers)
+}
+
+type DatasetSummary struct {
+	Dir      string             `json:"dir"`
+	Options  dataset.Options    `json:"options"`
+	Files    []dataset.FileInfo `json:"files"`
+	Distinct int                `json:"distinct"`
+	Valid    int                `json:"valid"`
+}
+
+type Report struct {
+	StartedAt time.Time      `json:"startedAt"`
+	GoVersion string         `json:"goVersion"`
+	OS        string         `json:"os"`
+	Arch      string         `json:"arch"`
+	CPUs      int            `json:"cpus"`
+	Dataset   DatasetSummary `json:"dataset"`
+	// ColdEvicted is false where the files can not be evicted from the page cache, the cold
+	// lookups are then only the first lookups after the index build.
+	ColdEvicted bool     `json:"coldEvicted"`
+	Results     []Result `json:"results"`
+}
+
+// Dataset is a generated dataset ready to be searched.
+type Dataset struct {
+	Dir      string
+	Manifest *dataset.Manifest
+	// Codes are the sample codes of the manifest, valid or not as Expected says.
+	Codes    []string
+	Expected []bool
+	// ValidCouponsPath is the valid coupons file the precomputed reader serves.
+	ValidCouponsPath string
+}
+
+// Prepare loads the dataset in dir, generating it with opts when dir has no manifest, and writes
+// its valid coupons file and the btree indexes of its files.
+func Prepare(dir string, opts dataset.Options) (*Dataset, error) {
+	m, err := dataset.LoadManifest(dir)
+	if os.IsNotExist(err) {
+		m, err = dataset.Generate(dir, opts)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if m.Options.Unsorted {
+		return nil, fmt.Errorf("the dataset in %s is not sorted", dir)
+	}
+
+	ds := &Dataset{Dir: dir, Manifest: m, ValidCouponsPath: filepath.Join(dir, reader.ValidCouponsFile)}
+	for _, c := range m.Valid {
+		ds.Codes, ds.Expected = append(ds.Codes, c.Code), append(ds.Expected, true)
+	}
+	for _, c := range m.Invalid {
+		ds.Codes, ds.Expected = append(ds.Codes, c.Code), append(ds.Expected, false)
+	}
+	for _, code := range m.Absent {
+		ds.Codes, ds.Expected = append(ds.Codes, code), append(ds.Expected, false)
+	}
+	if len(ds.Codes) == 0 {
+		return nil, fmt.Errorf("the manifest in %s lists no codes to look up", dir)
+	}
+	if err := writeValidCoupons(ds); err != nil {
+		return nil, fmt.Errorf("failed to write the valid coupons file: %w", err)
+	}
+	for _, path := range m.Paths(dir) {
+		if _, err := btree.Build(path, btree.IndexPath(path), btree.DefaultOptions()); err != nil {
+			return nil, fmt.Errorf("failed to build the btree index: %w", err)
+		}
+	}
+	return ds, nil
+}
+
+// Policy is the policy the manifest of the dataset was written for.
+func (ds *Dataset) Policy() reader.Policy {
+	opts := ds.Manifest.Options
+	p, _ := reader.NewRulePolicy(reader.RulePolicy{
+		MinFileMatches: opts.MinFiles,
+		MinLength:      opts.MinLength,
+		MaxLength:      opts.MaxLength,
+		CaseSensitive:  true,
+	})
+	return p
+}
+
+func writeValidCoupons(ds *Dataset) error {
+	f, err := os.Create(ds.ValidCouponsPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	if _, err := validset.Build(ds.Manifest.Paths(ds.Dir), w, ds.Policy()); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// NewReader starts the reader and waits for its indexes, returning how long the build took.
+func (ds *Dataset) NewReader(readerType string, chunkSize, workers, buildConcurrency int) (reader.FileReader, time.Duration, error) {
+	start := time.Now()
+	r, err := reader.GetFileReader(readerType, reader.Options{
+		RootPath:           ds.Dir,
+		ChunkSize:          chunkSize,
+		SearchWorkerPool:   workers,
+		BuildConcurrency:   buildConcurrency,
+		PendingMode:        reader.PendingWait,
+		PendingWaitTimeout: time.Hour,
+		ValidCouponsPath:   ds.ValidCouponsPath,
+		Policy:             ds.Policy(),
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	for {
+		status := r.Status()
+		switch status.State {
+		case reader.StateReady:
+			return r, time.Since(start), nil
+		case reader.StateFailed:
+			return nil, 0, fmt.Errorf("index build failed: %s", status.Error)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// Paths returns the files a reader of the type searches.
+func (ds *Dataset) Paths(readerType string) []string {
+	paths := ds.Manifest.Paths(ds.Dir)
+	switch readerType {
+	case reader.PrecomputedReader:
+		return []string{ds.ValidCouponsPath}
+	case reader.BTreeReader:
+		for _, path := range ds.Manifest.Paths(ds.Dir) {
+			paths = append(paths, btree.IndexPath(path))
+		}
+	}
+	return paths
+}
+
+// Run runs every case of the config.
+func Run(ctx context.Context, cfg Config) (*Report, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	dir := cfg.Dir
+	if dir == "" {
+		tmp, err := os.MkdirTemp("", "kart-bench-")
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(tmp)
+		dir = tmp
+	}
+	ds, err := Prepare(dir, cfg.Dataset)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{
+		StartedAt:   time.Now().UTC(),
+		GoVersion:   runtime.Version(),
+		OS:          runtime.GOOS,
+		Arch:        runtime.GOARCH,
+		CPUs:        runtime.NumCPU(),
+		ColdEvicted: canEvict,
+		Dataset: DatasetSummary{
+			Dir:      cfg.Dir,
+			Options:  ds.Manifest.Options,
+			Files:    ds.Manifest.Files,
+			Distinct: ds.Manifest.Distinct,
+			Valid:    ds.Manifest.ValidCount,
+		},
+		Results: []Result{},
+	}
+	for _, readerType := range cfg.Readers {
+		chunkSizes := cfg.ChunkSizes
+		if readerType == reader.BTreeReader {
+			// the btree indexes are built once, offline, the chunk size does not apply
+			chunkSizes = []int{0}
+		}
+		for _, chunkSize := range chunkSizes {
+			for _, workers := range cfg.Workers {
+				if err := ctx.Err(); err != nil {
+					return nil, err
+				}
+				result, err := runCase(ctx, ds, cfg, readerType, chunkSize, workers)
+				if err != nil {
+					return nil, fmt.Errorf("%s/chunk=%d/workers=%d: %w", readerType, chunkSize, workers, err)
+				}
+				report.Results = append(report.Results, result)
+			}
+		}
+	}
+	return report, nil
+}
+
+func runCase(ctx context.Context, ds *Dataset, cfg Config, readerType string, chunkSize, workers int) (Result, error) {
+	result := Result{Reader: readerType, ChunkSize: chunkSize, Workers: workers}
+	for _, path := range ds.Paths(readerType) {
+		if err := evict(path); err != nil {
+			return result, err
+		}
+	}
+	r, buildDuration, err := ds.NewReader(readerType, chunkSize, workers, cfg.BuildConcurrency)
+	if err != nil {
+		return result, err
+	}
+	result.IndexBuildMs = float64(buildDuration.Microseconds()) / 1e3
+	for _, file := range r.Status().Files {
+		result.IndexEntries += file.IndexEntries
+	}
+
+	lookup := func(i int) time.Duration {
+		code := ds.Codes[i%len(ds.Codes)]
+		start := time.Now()
+		valid, err := r.SearchPromo(ctx, code)
+		elapsed := time.Since(start)
+		if err != nil {
+			result.Errors++
+		} else if valid != ds.Expected[i%len(ds.Codes)] {
+			result.Wrong++
+		}
+		return elapsed
+	}
+
+	cold := make([]time.Duration, 0, cfg.ColdLookups)
+	for i := range cfg.ColdLookups {
+		for _, path := range ds.Paths(readerType) {
+			if err := evict(path); err != nil {
+				return result, err
+			}
+		}
+		cold = append(cold, lookup(i))
+	}
+	result.Cold = newLatency(cold)
+
+	// one pass over the codes brings their blocks into the page cache
+	for i := range ds.Codes {
+		lookup(i)
+	}
+	warm := make([]time.Duration, cfg.Lookups)
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	for i := range warm {
+		warm[i] = lookup(i)
+	}
+	runtime.ReadMemStats(&after)
+	result.Warm = newLatency(warm)
+	result.AllocsPerLookup = float64(after.Mallocs-before.Mallocs) / float64(cfg.Lookups)
+	result.BytesPerLookup = float64(after.TotalAlloc-before.TotalAlloc) / float64(cfg.Lookups)
+	return result, nil
+}
+
+// Regression is a metric of a case that got worse than the baseline allows.
+type Regression struct {
+	Case     string  `json:"case"`
+	Metric   string  `json:"metric"`
+	Baseline float64 `json:"baseline"`
+	Current  float64 `json:"current"`
+}
+
+// Compare returns the cases of current whose warm latency percentiles or allocations grew by more
+// than tolerance, 0.2 for 20%, over the same case of baseline, and those answering any lookup wrong.
+// Cases missing from the baseline are not compared.
+func Compare(baseline, current *Report, tolerance float64) []Regression {
+	base := make(map[string]Result, len(baseline.Results))
+	for _, r := range baseline.Results {
+		base[r.Key()] = r
+	}
+	regressions := []Regression{}
+	for _, r := range current.Results {
+		if r.Wrong > 0 || r.Errors > 0 {
+			regressions = append(regressions, Regression{Case: r.Key(), Metric: "wrong+errors", Current: float64(r.Wrong + r.Errors)})
+		}
+		b, ok := base[r.Key()]
+		if !ok {
+			continue
+		}
+		for _, m := range []struct {
+			name              string
+			baseline, current float64
+		}{
+			{"warm.p50Us", b.Warm.P50Us, r.Warm.P50Us},
+			{"warm.p99Us", b.Warm.P99Us, r.Warm.P99Us},
+			{"allocsPerLookup", b.AllocsPerLookup, r.AllocsPerLookup},
+		} {
+			if m.current > m.baseline*(1+tolerance) {
+				regressions = append(regressions, Regression{Case: r.Key(), Metric: m.name, Baseline: m.baseline, Current: m.current})
+			}
+		}
+	}
+	return regressions
+}
@@ -0,0 +1,21 @@
+//go:build linux
+
+package bench
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+const canEvict = true
+
+// evict drops the cached pages of the file, so the next read of it goes to the disk.
+func evict(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return unix.Fadvise(int(f.Fd()), 0, 0, unix.FADV_DONTNEED)
+}
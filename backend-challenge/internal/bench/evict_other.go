@@ -0,0 +1,9 @@
+//go:build !linux
+
+package bench
+
+const canEvict = false
+
+func evict(path string) error {
+	return nil
+}
@@ -0,0 +1,157 @@
+// Package blockgz reads and writes block-gzip files: a concatenation of independent gzip members,
+// each holding whole lines. Any gzip tool can decompress the whole file, while a reader that knows
+// the offset of a member can start decompressing there without touching the blocks before it.
+package blockgz
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+)
+
+// DefaultBlockSize is the uncompressed size a block is closed at, on the next line end.
+const DefaultBlockSize = 256 * 1024
+
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// IsBlockGzip reports whether the file starts with the gzip magic bytes.
+func IsBlockGzip(path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	head := make([]byte, len(gzipMagic))
+	if _, err := io.ReadFull(f, head); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return false, nil
+		}
+		return false, err
+	}
+	return bytes.Equal(head, gzipMagic), nil
+}
+
+// Writer compresses lines into blocks of about blockSize uncompressed bytes. Blocks only end on
+// a line end, so a line is never split across two blocks.
+type Writer struct {
+	w         io.Writer
+	blockSize int
+	buf       bytes.Buffer
+	gz        *gzip.Writer
+}
+
+func NewWriter(w io.Writer, blockSize int) *Writer {
+	if blockSize <= 0 {
+		blockSize = DefaultBlockSize
+	}
+	return &Writer{
+		w:         w,
+		blockSize: blockSize,
+	}
+}
+
+// Write buffers p and writes out every full block up to the last complete line.
+func (w *Writer) Write(p []byte) (int, error) {
+	w.buf.Write(p)
+	for w.buf.Len() >= w.blockSize {
+		end := bytes.LastIndexByte(w.buf.Bytes(), '\n')
+		if end < 0 {
+			// a single line longer than a block, wait for its end
+			break
+		}
+		if err := w.writeBlock(w.buf.Next(end + 1)); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+func (w *Writer) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Close writes the last block. It does not close the underlying writer.
+func (w *Writer) Close() error {
+	if w.buf.Len() == 0 {
+		return nil
+	}
+	return w.writeBlock(w.buf.Next(w.buf.Len()))
+}
+
+func (w *Writer) writeBlock(block []byte) error {
+	if w.gz == nil {
+		gz, err := gzip.NewWriterLevel(w.w, gzip.BestCompression)
+		if err != nil {
+			return err
+		}
+		w.gz = gz
+	} else {
+		w.gz.Reset(w.w)
+	}
+	if _, err := w.gz.Write(block); err != nil {
+		return err
+	}
+	return w.gz.Close()
+}
+
+// countingReader counts the bytes consumed from r. It is an io.ByteReader, so gzip reads from it
+// directly instead of adding a buffer of its own, which keeps the count at the exact end of a member.
+type countingReader struct {
+	r *bufio.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (c *countingReader) ReadByte() (byte, error) {
+	b, err := c.r.ReadByte()
+	if err == nil {
+		c.n++
+	}
+	return b, err
+}
+
+// Blocks calls fn for every block of r, with the offset of the block in r and its decompressed
+// content. fn does not need to read the block to its end.
+func Blocks(r io.Reader, fn func(offset int64, block io.Reader) error) error {
+	cr := &countingReader{r: bufio.NewReaderSize(r, 1<<20)}
+	var zr gzip.Reader
+	for {
+		offset := cr.n
+		if err := zr.Reset(cr); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		zr.Multistream(false)
+
+		if err := fn(offset, &zr); err != nil {
+			return err
+		}
+		if _, err := io.Copy(io.Discard, &zr); err != nil {
+			return err
+		}
+	}
+}
+
+// NewReaderAt returns the decompressed content of f from the block at offset to the end of the file.
+func NewReaderAt(f io.ReadSeeker, offset int64) (io.ReadCloser, error) {
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return gzip.NewReader(bufio.NewReader(f))
+}
+
+// NewReader returns the decompressed content of a whole block-gzip file.
+func NewReader(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
@@ -0,0 +1,288 @@
+// Package btree reads and writes multi-level on-disk indexes of sorted coupon files. The leaf pages
+// map the first code of every stride of the coupon file to its offset, and each level of inner
+// pages maps the first code of every page of the level below to its page number, up to a single
+// root page. A reader keeps the root page in memory and reads one page per level below it, so a
+// lookup costs a bounded number of page reads however large the coupon file grows.
+//
+// The index file is a header page followed by the tree pages, all of the same size. A page is its
+// level, 0 for the leaves, its entry count and the entries, each a key and a value, the data offset
+// in a leaf and the page number of a child in an inner page.
+package btree
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const (
+	// Dir is the folder next to the coupon files that holds their indexes.
+	Dir = "btree"
+	// Ext is the extension of an index file, added to the name of its coupon file.
+	Ext = ".btree"
+
+	DefaultPageSize = 4096
+	// DefaultStride is the distance in bytes between two leaf entries of a plain coupon file.
+	DefaultStride = 4096
+	// MinPageSize keeps room for the header and for at least 3 entries of the longest key.
+	MinPageSize = 1024
+	// MaxPageSize keeps the entry count of a page within its 16 bits.
+	MaxPageSize = 64 * 1024
+	// MaxKeyLength is the longest code that can be indexed.
+	MaxKeyLength = 255
+)
+
+var magic = []byte("KARTBT01")
+
+// pageHeaderSize is the level and the entry count at the start of every page.
+const pageHeaderSize = 3
+
+var (
+	// ErrStale is returned by Check when the coupon file changed since its index was built.
+	ErrStale = errors.New("the index was built for another version of the coupon file")
+	// ErrChanged is returned by Seek when the index file was replaced since it was opened.
+	ErrChanged = errors.New("the index file changed since it was loaded")
+)
+
+// IndexPath returns the path of the index of a coupon file, in Dir next to it.
+func IndexPath(dataPath string) string {
+	return filepath.Join(filepath.Dir(dataPath), Dir, filepath.Base(dataPath)+Ext)
+}
+
+// Info describes an index and the coupon file it was built for.
+type Info struct {
+	PageSize int `json:"pageSize"`
+	// Height is the number of levels, 1 when the root page is the only leaf.
+	Height int `json:"height"`
+	// Pages is the number of tree pages, the header page aside.
+	Pages int64 `json:"pages"`
+	// Entries is the number of leaf entries.
+	Entries int64 `json:"entries"`
+	// Stride is the distance in bytes between leaf entries of a plain file, zero for block-gzip
+	// files, which have a leaf entry per block.
+	Stride      int64     `json:"stride,omitempty"`
+	BlockGzip   bool      `json:"blockGzip"`
+	FirstKey    string    `json:"firstKey"`
+	LastKey     string    `json:"lastKey"`
+	DataSize    int64     `json:"dataSize"`
+	DataModTime time.Time `json:"dataModTime"`
+	BuiltAt     time.Time `json:"builtAt"`
+}
+
+// header is the first page of an index file.
+type header struct {
+	Info
+	root int64
+}
+
+func (h header) marshal() []byte {
+	var flags byte
+	if h.BlockGzip {
+		flags = 1
+	}
+	buf := bytes.NewBuffer(make([]byte, 0, h.PageSize))
+	buf.Write(magic)
+	buf.Write(binary.LittleEndian.AppendUint32(nil, uint32(h.PageSize)))
+	buf.WriteByte(byte(h.Height))
+	buf.WriteByte(flags)
+	for _, v := range []int64{h.root, h.Pages, h.Entries, h.Stride, h.DataSize, h.DataModTime.UnixNano(), h.BuiltAt.UnixNano()} {
+		buf.Write(binary.LittleEndian.AppendUint64(nil, uint64(v)))
+	}
+	for _, key := range []string{h.FirstKey, h.LastKey} {
+		buf.WriteByte(byte(len(key)))
+		buf.WriteString(key)
+	}
+	return buf.Bytes()
+}
+
+func unmarshalHeader(r io.Reader) (header, error) {
+	var h header
+	head := make([]byte, len(magic)+4+2+7*8)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return h, fmt.Errorf("not a coupon index: %w", err)
+	}
+	if !bytes.Equal(head[:len(magic)], magic) {
+		return h, errors.New("not a coupon index")
+	}
+	rest := head[len(magic):]
+	h.PageSize = int(binary.LittleEndian.Uint32(rest))
+	h.Height = int(rest[4])
+	h.BlockGzip = rest[5]&1 != 0
+	values := make([]int64, 7)
+	for i := range values {
+		values[i] = int64(binary.LittleEndian.Uint64(rest[6+8*i:]))
+	}
+	h.root, h.Pages, h.Entries, h.Stride, h.DataSize = values[0], values[1], values[2], values[3], values[4]
+	h.DataModTime, h.BuiltAt = time.Unix(0, values[5]), time.Unix(0, values[6])
+	for _, key := range []*string{&h.FirstKey, &h.LastKey} {
+		var n [1]byte
+		if _, err := io.ReadFull(r, n[:]); err != nil {
+			return h, fmt.Errorf("corrupt index header: %w", err)
+		}
+		b := make([]byte, n[0])
+		if _, err := io.ReadFull(r, b); err != nil {
+			return h, fmt.Errorf("corrupt index header: %w", err)
+		}
+		*key = string(b)
+	}
+	if h.PageSize < MinPageSize || h.PageSize > MaxPageSize || h.Height < 1 || h.root < 1 || h.root > h.Pages {
+		return h, errors.New("corrupt index header")
+	}
+	return h, nil
+}
+
+// page is a decoded tree page.
+type page struct {
+	level  int
+	keys   []string
+	values []int64
+}
+
+func decodePage(buf []byte, number int64) (page, error) {
+	corrupt := fmt.Errorf("corrupt index page %d", number)
+	if len(buf) < pageHeaderSize {
+		return page{}, corrupt
+	}
+	p := page{level: int(buf[0])}
+	count := int(binary.LittleEndian.Uint16(buf[1:]))
+	p.keys = make([]string, 0, count)
+	p.values = make([]int64, 0, count)
+	rest := buf[pageHeaderSize:]
+	for range count {
+		n, size := binary.Uvarint(rest)
+		if size <= 0 || n > uint64(len(rest)-size) {
+			return page{}, corrupt
+		}
+		p.keys = append(p.keys, string(rest[size:size+int(n)]))
+		rest = rest[size+int(n):]
+		value, size := binary.Uvarint(rest)
+		if size <= 0 {
+			return page{}, corrupt
+		}
+		p.values = append(p.values, int64(value))
+		rest = rest[size:]
+	}
+	return p, nil
+}
+
+// below returns the index of the last entry whose key is lower than key, -1 when there is none.
+func (p page) below(key string) int {
+	return sort.SearchStrings(p.keys, key) - 1
+}
+
+// Tree is an opened index. Only the header and the root page are held in memory, the pages below
+// the root are read from the index file by every lookup.
+type Tree struct {
+	path string
+	file os.FileInfo
+	header
+	root page
+}
+
+// Open reads the header and the root page of the index at path.
+func Open(path string) (*Tree, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	file, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	h, err := unmarshalHeader(io.LimitReader(f, MinPageSize))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	t := &Tree{path: path, file: file, header: h}
+	if t.root, err = t.readPage(f, h.root); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if t.root.level != h.Height-1 {
+		return nil, fmt.Errorf("%s: corrupt index page %d", path, h.root)
+	}
+	return t, nil
+}
+
+func (t *Tree) Info() Info {
+	return t.header.Info
+}
+
+func (t *Tree) Path() string {
+	return t.path
+}
+
+// Check returns ErrStale when data, the stat of the coupon file, is not the file the index was built for.
+func (t *Tree) Check(data os.FileInfo) error {
+	if data.Size() != t.DataSize || !data.ModTime().Equal(t.DataModTime) {
+		return fmt.Errorf("%w: built for %d bytes modified at %s, the file has %d bytes modified at %s",
+			ErrStale, t.DataSize, t.DataModTime.UTC().Format(time.RFC3339Nano),
+			data.Size(), data.ModTime().UTC().Format(time.RFC3339Nano))
+	}
+	return nil
+}
+
+// Seek returns the offset in the coupon file to read from to find key: the offset of the last leaf
+// entry below key, so the code is at most one stride or block after it if the file holds it. It
+// reads one page per level below the root and returns the number of pages read.
+func (t *Tree) Seek(key string) (offset int64, reads int, err error) {
+	p := t.root
+	var f *os.File
+	for p.level > 0 {
+		if f == nil {
+			if f, err = t.open(); err != nil {
+				return 0, reads, err
+			}
+			defer f.Close()
+		}
+		child := p.values[max(p.below(key), 0)]
+		next, err := t.readPage(f, child)
+		reads++
+		if err != nil {
+			return 0, reads, err
+		}
+		if next.level != p.level-1 {
+			return 0, reads, fmt.Errorf("%s: corrupt index page %d", t.path, child)
+		}
+		p = next
+	}
+	if i := p.below(key); i >= 0 {
+		return p.values[i], reads, nil
+	}
+	return 0, reads, nil
+}
+
+// open opens the index file, which must still be the file the tree was opened from.
+func (t *Tree) open() (*os.File, error) {
+	f, err := os.Open(t.path)
+	if err != nil {
+		return nil, err
+	}
+	file, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if !os.SameFile(file, t.file) || file.ModTime() != t.file.ModTime() {
+		f.Close()
+		return nil, fmt.Errorf("%s: %w", t.path, ErrChanged)
+	}
+	return f, nil
+}
+
+func (t *Tree) readPage(f io.ReaderAt, number int64) (page, error) {
+	if number < 1 || number > t.Pages {
+		return page{}, fmt.Errorf("corrupt index, page %d out of range", number)
+	}
+	buf := make([]byte, t.PageSize)
+	if _, err := f.ReadAt(buf, number*int64(t.PageSize)); err != nil {
+		return page{}, fmt.Errorf("failed to read index page %d: %w", number, err)
+	}
+	return decodePage(buf, number)
+}
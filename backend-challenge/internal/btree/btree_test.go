@@ -0,0 +1,243 @@
+package btree
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeData writes the lines as a coupon file and returns its path and the offset of every line.
+func writeData(t *testing.T, lines []string) (string, []int64) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "couponbase1")
+	offsets := make([]int64, len(lines))
+	var data strings.Builder
+	for i, line := range lines {
+		offsets[i] = int64(data.Len())
+		data.WriteString(line + "\n")
+	}
+	if err := os.WriteFile(path, []byte(data.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path, offsets
+}
+
+func buildTree(t *testing.T, path string, opts Options) *Tree {
+	t.Helper()
+	built, err := Build(path, IndexPath(path), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, err := Open(IndexPath(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := tree.Info()
+	if info.Height != built.Height || info.Pages != built.Pages || info.Entries != built.Entries ||
+		info.FirstKey != built.FirstKey || info.LastKey != built.LastKey || info.DataSize != built.DataSize ||
+		!info.DataModTime.Equal(built.DataModTime) || !info.BuiltAt.Equal(built.BuiltAt) {
+		t.Fatalf("the header read back is %+v, the build wrote %+v", info, built)
+	}
+	return tree
+}
+
+// leafEntries returns the keys and offsets of the leaf entries: the first line and then the first
+// line a stride or more after the previous entry.
+func leafEntries(lines []string, offsets []int64, stride int64) ([]string, []int64) {
+	var keys []string
+	var entries []int64
+	for i, line := range lines {
+		if i > 0 && offsets[i]-entries[len(entries)-1] < stride {
+			continue
+		}
+		keys, entries = append(keys, line), append(entries, offsets[i])
+	}
+	return keys, entries
+}
+
+// checkSeeks seeks every key and checks the offset is the one of the last leaf entry below it.
+func checkSeeks(t *testing.T, tree *Tree, lines []string, offsets []int64, keys []string) {
+	t.Helper()
+	entryKeys, entries := leafEntries(lines, offsets, tree.Stride)
+	for _, key := range keys {
+		offset, reads, err := tree.Seek(key)
+		if err != nil {
+			t.Fatalf("Seek(%q): %v", key, err)
+		}
+		var want int64
+		if i := sort.SearchStrings(entryKeys, key) - 1; i >= 0 {
+			want = entries[i]
+		}
+		if offset != want {
+			t.Fatalf("Seek(%q) = offset %d, want %d", key, offset, want)
+		}
+		if reads != tree.Height-1 {
+			t.Fatalf("Seek(%q) read %d pages, want one per level below the root, %d", key, reads, tree.Height-1)
+		}
+	}
+}
+
+// codes returns n sorted distinct codes.
+func codes(n int) []string {
+	lines := make([]string, n)
+	for i := range lines {
+		lines[i] = fmt.Sprintf("CODE%06d", i*2)
+	}
+	return lines
+}
+
+// probes returns every line, and a key just below, just above, before and after all of them.
+func probes(lines []string) []string {
+	keys := []string{"", "A", "ZZZZ"}
+	for _, line := range lines {
+		keys = append(keys, line, line[:len(line)-1], line+"0")
+	}
+	return keys
+}
+
+func TestSmallerThanOnePage(t *testing.T) {
+	lines := codes(20)
+	path, offsets := writeData(t, lines)
+	tree := buildTree(t, path, Options{PageSize: MinPageSize, Stride: 30})
+
+	if tree.Height != 1 || tree.Pages != 1 {
+		t.Fatalf("height %d with %d pages, want the root as the only leaf", tree.Height, tree.Pages)
+	}
+	if tree.FirstKey != lines[0] || tree.LastKey != lines[len(lines)-1] {
+		t.Fatalf("keys %q to %q, want %q to %q", tree.FirstKey, tree.LastKey, lines[0], lines[len(lines)-1])
+	}
+	checkSeeks(t, tree, lines, offsets, probes(lines))
+}
+
+func TestInnerPageKeys(t *testing.T) {
+	// an entry per line and about 90 entries per page give 3 levels
+	lines := codes(20_000)
+	path, offsets := writeData(t, lines)
+	tree := buildTree(t, path, Options{PageSize: MinPageSize, Stride: 1})
+	if tree.Height != 3 {
+		t.Fatalf("height %d, want 3", tree.Height)
+	}
+
+	// the keys of the inner pages are the first keys of the pages below them
+	f, err := tree.open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	keys := append([]string{}, tree.root.keys...)
+	for _, child := range tree.root.values {
+		p, err := tree.readPage(f, child)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, p.keys...)
+	}
+	checkSeeks(t, tree, lines, offsets, probes(keys))
+	checkSeeks(t, tree, lines, offsets, probes(lines))
+}
+
+func TestDuplicatesAcrossPages(t *testing.T) {
+	// 300 copies of a code span about 3 leaf pages, the first key of the pages after the first
+	// copy is the duplicate itself
+	var lines []string
+	for i := range 200 {
+		lines = append(lines, fmt.Sprintf("AAAA%06d", i))
+	}
+	for range 300 {
+		lines = append(lines, "MMMM000000")
+	}
+	for i := range 200 {
+		lines = append(lines, fmt.Sprintf("ZZZZ%06d", i))
+	}
+	path, offsets := writeData(t, lines)
+	tree := buildTree(t, path, Options{PageSize: MinPageSize, Stride: 1})
+	if tree.Height < 2 {
+		t.Fatalf("height %d, want the duplicates on more than one page", tree.Height)
+	}
+	checkSeeks(t, tree, lines, offsets, probes(lines))
+
+	// reading from the offset reaches the first copy
+	offset, _, err := tree.Seek("MMMM000000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if offset != offsets[199] {
+		t.Fatalf("Seek of the duplicate = offset %d, want the line before its first copy at %d", offset, offsets[199])
+	}
+}
+
+func TestEmptyFile(t *testing.T) {
+	path, _ := writeData(t, nil)
+	tree := buildTree(t, path, DefaultOptions())
+	if tree.Entries != 0 || tree.Height != 1 || tree.FirstKey != "" {
+		t.Fatalf("%d entries, height %d, first key %q, want an empty root", tree.Entries, tree.Height, tree.FirstKey)
+	}
+	for _, key := range []string{"", "CODE"} {
+		if offset, reads, err := tree.Seek(key); err != nil || offset != 0 || reads != 0 {
+			t.Fatalf("Seek(%q) = %d, %d reads, %v, want offset 0 from the root", key, offset, reads, err)
+		}
+	}
+}
+
+func TestStaleIndex(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(t *testing.T, path string)
+		stale  bool
+	}{
+		{"unchanged", func(*testing.T, string) {}, false},
+		{"appended", func(t *testing.T, path string) {
+			f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			if _, err := f.WriteString("ZZZZ000000\n"); err != nil {
+				t.Fatal(err)
+			}
+		}, true},
+		{"same size, modified later", func(t *testing.T, path string) {
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, []byte(strings.Repeat("B", int(info.Size())-1)+"\n"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			later := info.ModTime().Add(time.Second)
+			if err := os.Chtimes(path, later, later); err != nil {
+				t.Fatal(err)
+			}
+		}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, _ := writeData(t, codes(100))
+			tree := buildTree(t, path, DefaultOptions())
+			tt.modify(t, path)
+
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := tree.Check(info); errors.Is(err, ErrStale) != tt.stale {
+				t.Fatalf("Check = %v, want stale %t", err, tt.stale)
+			}
+		})
+	}
+}
+
+func TestUnsortedFileFailsTheBuild(t *testing.T) {
+	path, _ := writeData(t, []string{"CODE000002", "CODE000001"})
+	if _, err := Build(path, IndexPath(path), DefaultOptions()); err == nil || !strings.Contains(err.Error(), "not sorted") {
+		t.Fatalf("Build of an unsorted file = %v, want a not sorted error", err)
+	}
+	if _, err := os.Stat(IndexPath(path)); !os.IsNotExist(err) {
+		t.Fatalf("the failed build left an index: %v", err)
+	}
+}
@@ -0,0 +1,260 @@
+package btree
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dekanayake/kart-challenge/backend-challenge/internal/blockgz"
+	"github.com/dekanayake/kart-challenge/backend-challenge/internal/coupon"
+	"github.com/dekanayake/kart-challenge/backend-challenge/internal/verify"
+)
+
+// Options configures the build of an index.
+type Options struct {
+	PageSize int
+	// Stride is the distance in bytes between two leaf entries of a plain coupon file.
+	Stride int64
+}
+
+func DefaultOptions() Options {
+	return Options{PageSize: DefaultPageSize, Stride: DefaultStride}
+}
+
+func (o Options) Validate() error {
+	if o.PageSize < MinPageSize || o.PageSize > MaxPageSize {
+		return fmt.Errorf("page size must be between %d and %d bytes", MinPageSize, MaxPageSize)
+	}
+	if o.Stride <= 0 {
+		return fmt.Errorf("stride must be greater than 0")
+	}
+	return nil
+}
+
+// Build indexes the sorted coupon file at dataPath into an index file at indexPath, creating its
+// folder. The index is written next to indexPath and renamed into place, a reader never sees a
+// partly written index. A coupon file that is not sorted fails the build.
+func Build(dataPath, indexPath string, opts Options) (Info, error) {
+	if err := opts.Validate(); err != nil {
+		return Info{}, err
+	}
+	compressed, err := blockgz.IsBlockGzip(dataPath)
+	if err != nil {
+		return Info{}, err
+	}
+	data, err := os.Open(dataPath)
+	if err != nil {
+		return Info{}, err
+	}
+	defer data.Close()
+	stat, err := data.Stat()
+	if err != nil {
+		return Info{}, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(indexPath), 0o755); err != nil {
+		return Info{}, err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(indexPath), filepath.Base(indexPath)+".*.tmp")
+	if err != nil {
+		return Info{}, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	b := newBuilder(tmp, opts.PageSize)
+	h := header{Info: Info{
+		PageSize:    opts.PageSize,
+		Stride:      opts.Stride,
+		BlockGzip:   compressed,
+		DataSize:    stat.Size(),
+		DataModTime: stat.ModTime(),
+	}}
+	if compressed {
+		h.Stride = 0
+		err = indexBlocks(data, b, &h.Info)
+	} else {
+		err = indexLines(data, b, &h.Info)
+	}
+	if err != nil {
+		return Info{}, fmt.Errorf("%s: %w", dataPath, err)
+	}
+	if h.root, h.Height, err = b.finish(); err != nil {
+		return Info{}, err
+	}
+	h.Pages = b.pages - 1
+	h.Entries = b.entries
+	h.BuiltAt = time.Now()
+
+	if err := b.w.Flush(); err != nil {
+		return Info{}, err
+	}
+	if _, err := tmp.WriteAt(h.marshal(), 0); err != nil {
+		return Info{}, err
+	}
+	if err := tmp.Close(); err != nil {
+		return Info{}, err
+	}
+	return h.Info, os.Rename(tmp.Name(), indexPath)
+}
+
+// indexLines adds a leaf entry for the first line of the file and then for the first line starting
+// a stride or more after the previous entry.
+func indexLines(data io.Reader, b *builder, info *Info) error {
+	scanner := bufio.NewScanner(data)
+	scanner.Split(verify.ScanRawLines)
+	var offset, last int64
+	for scanner.Scan() {
+		raw := scanner.Bytes()
+		lineOffset := offset
+		offset += int64(len(raw) + 1)
+		line := strings.TrimSpace(string(raw))
+		if line == "" {
+			continue
+		}
+		key := coupon.Key(line)
+		if err := track(info, key, lineOffset); err != nil {
+			return err
+		}
+		if b.entries == 0 || lineOffset-last >= info.Stride {
+			last = lineOffset
+			if err := b.add(0, key, lineOffset); err != nil {
+				return err
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+// indexBlocks adds a leaf entry per block, its first code and the offset of the compressed block.
+func indexBlocks(data io.Reader, b *builder, info *Info) error {
+	var dataOffset int64
+	return blockgz.Blocks(data, func(offset int64, block io.Reader) error {
+		first := true
+		scanner := bufio.NewScanner(block)
+		scanner.Split(verify.ScanRawLines)
+		for scanner.Scan() {
+			raw := scanner.Bytes()
+			lineOffset := dataOffset
+			dataOffset += int64(len(raw) + 1)
+			line := strings.TrimSpace(string(raw))
+			if line == "" {
+				continue
+			}
+			key := coupon.Key(line)
+			if err := track(info, key, lineOffset); err != nil {
+				return err
+			}
+			if first {
+				first = false
+				if err := b.add(0, key, offset); err != nil {
+					return err
+				}
+			}
+		}
+		return scanner.Err()
+	})
+}
+
+// track records the first and last key of the file and checks the keys are sorted and fit a page.
+func track(info *Info, key string, offset int64) error {
+	if len(key) > MaxKeyLength {
+		return fmt.Errorf("code at offset %d is longer than %d bytes", offset, MaxKeyLength)
+	}
+	if info.FirstKey == "" {
+		info.FirstKey = key
+	} else if key < info.LastKey {
+		return fmt.Errorf("coupon file is not sorted, %q at offset %d comes after %q", key, offset, info.LastKey)
+	}
+	info.LastKey = key
+	return nil
+}
+
+// builder writes the pages bottom up while the leaf entries are added in order. Every level has
+// one open page, a full page is written out and its first key added to the level above.
+type builder struct {
+	w        *bufio.Writer
+	pageSize int
+	levels   []*openPage
+	// pages is the number of the next page, the header is page 0.
+	pages   int64
+	entries int64
+}
+
+type openPage struct {
+	count    int
+	firstKey string
+	buf      []byte
+}
+
+func newBuilder(f *os.File, pageSize int) *builder {
+	w := bufio.NewWriterSize(f, 64*1024)
+	// the header is written last, in place
+	w.Write(make([]byte, pageSize))
+	return &builder{w: w, pageSize: pageSize, levels: []*openPage{{}}, pages: 1}
+}
+
+func (b *builder) add(level int, key string, value int64) error {
+	if level == len(b.levels) {
+		b.levels = append(b.levels, &openPage{})
+	}
+	if level == 0 {
+		b.entries++
+	}
+	entry := binary.AppendUvarint(nil, uint64(len(key)))
+	entry = append(entry, key...)
+	entry = binary.AppendUvarint(entry, uint64(value))
+
+	p := b.levels[level]
+	if p.count > 0 && pageHeaderSize+len(p.buf)+len(entry) > b.pageSize {
+		number, err := b.write(level, p)
+		if err != nil {
+			return err
+		}
+		if err := b.add(level+1, p.firstKey, number); err != nil {
+			return err
+		}
+		*p = openPage{buf: p.buf[:0]}
+	}
+	if p.count == 0 {
+		p.firstKey = key
+	}
+	p.count++
+	p.buf = append(p.buf, entry...)
+	return nil
+}
+
+func (b *builder) write(level int, p *openPage) (int64, error) {
+	page := make([]byte, b.pageSize)
+	page[0] = byte(level)
+	binary.LittleEndian.PutUint16(page[1:], uint16(p.count))
+	copy(page[pageHeaderSize:], p.buf)
+	if _, err := b.w.Write(page); err != nil {
+		return 0, err
+	}
+	b.pages++
+	return b.pages - 1, nil
+}
+
+// finish writes the open page of every level, bottom up. The open page of the top level is the
+// root, no page of that level was written before.
+func (b *builder) finish() (root int64, height int, err error) {
+	for level := 0; ; level++ {
+		p := b.levels[level]
+		number, err := b.write(level, p)
+		if err != nil {
+			return 0, 0, err
+		}
+		if level == len(b.levels)-1 {
+			return number, level + 1, nil
+		}
+		if err := b.add(level+1, p.firstKey, number); err != nil {
+			return 0, 0, err
+		}
+	}
+}
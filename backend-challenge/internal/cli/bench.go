@@ -0,0 +1,135 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/dekanayake/kart-challenge/backend-challenge/internal/bench"
+)
+
+type benchOutput struct {
+	*bench.Report
+	Regressions []bench.Regression `json:"regressions,omitempty"`
+}
+
+// runBench benchmarks the readers over a generated dataset. With -baseline a case slower than the
+// baseline by more than -tolerance, or a wrong answer, is a failure.
+func runBench(c *cmdContext, args []string) int {
+	cfg := bench.DefaultConfig()
+	fs := c.flagSet()
+	fs.Int64Var(&cfg.Dataset.Seed, "seed", cfg.Dataset.Seed, "seed of the generated dataset")
+	fs.IntVar(&cfg.Dataset.Files, "files", cfg.Dataset.Files, "coupon files of the generated dataset")
+	fs.IntVar(&cfg.Dataset.Codes, "codes", cfg.Dataset.Codes, "codes per generated file, 0 works it out from -size")
+	fs.Int64Var(&cfg.Dataset.FileSize, "size", 0, "approximate bytes per generated file, used when -codes is 0")
+	fs.Float64Var(&cfg.Dataset.Overlap, "overlap", cfg.Dataset.Overlap, "share of the codes of each generated file that are also in other files")
+	fs.IntVar(&cfg.Dataset.BlockSize, "block-size", 0, "write the generated files as block-gzip in blocks of this many bytes")
+	fs.IntVar(&cfg.Dataset.Samples, "samples", 1000, "valid, invalid and absent codes looked up")
+	readers := fs.String("readers", strings.Join(cfg.Readers, ","), "comma separated reader types: hdd, precomputed or btree")
+	chunkSizes := fs.String("chunk-sizes", joinInts(cfg.ChunkSizes), "comma separated lines per index entry")
+	workers := fs.String("workers", joinInts(cfg.Workers), "comma separated search worker pool sizes")
+	fs.IntVar(&cfg.BuildConcurrency, "build-concurrency", cfg.BuildConcurrency, "files indexed at once")
+	fs.IntVar(&cfg.Lookups, "lookups", cfg.Lookups, "warm lookups per case")
+	fs.IntVar(&cfg.ColdLookups, "cold", cfg.ColdLookups, "cold lookups per case")
+	output := fs.String("o", "", "file to write the JSON report to")
+	baseline := fs.String("baseline", "", "JSON report of an earlier run to compare with")
+	tolerance := fs.Float64("tolerance", 0.2, "growth over the baseline allowed before a case is a regression, 0.2 is 20%")
+	if code, ok := c.parse(args, 0, 1); !ok {
+		return code
+	}
+	cfg.Dir = fs.Arg(0)
+
+	var err error
+	cfg.Readers = splitList(*readers)
+	if cfg.ChunkSizes, err = parseInts(*chunkSizes); err != nil {
+		return c.fail(fmt.Errorf("-chunk-sizes: %w", err))
+	}
+	if cfg.Workers, err = parseInts(*workers); err != nil {
+		return c.fail(fmt.Errorf("-workers: %w", err))
+	}
+	var base *bench.Report
+	if *baseline != "" {
+		data, err := os.ReadFile(*baseline)
+		if err != nil {
+			return c.fail(err)
+		}
+		if err := json.Unmarshal(data, &base); err != nil {
+			return c.fail(fmt.Errorf("%s: %w", *baseline, err))
+		}
+	}
+
+	report, err := bench.Run(context.Background(), cfg)
+	if err != nil {
+		return c.fail(err)
+	}
+	if *output != "" {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return c.fail(err)
+		}
+		if err := os.WriteFile(*output, append(data, '\n'), 0o644); err != nil {
+			return c.fail(err)
+		}
+	}
+	out := benchOutput{Report: report}
+	if base != nil {
+		out.Regressions = bench.Compare(base, report, *tolerance)
+	}
+
+	c.print(out, func(w io.Writer) {
+		fmt.Fprintf(w, "%d files, %d distinct codes, %s %s, %d CPUs, cold lookups evicted from the page cache: %t\n",
+			len(report.Dataset.Files), report.Dataset.Distinct, report.OS, report.Arch, report.CPUs, report.ColdEvicted)
+		fmt.Fprintf(w, "%-32s %10s %8s %10s %10s %10s %10s %10s %8s %6s\n",
+			"case", "build ms", "entries", "cold p50", "cold p99", "warm p50", "warm p90", "warm p99", "allocs", "wrong")
+		for _, r := range report.Results {
+			fmt.Fprintf(w, "%-32s %10.1f %8d %9.1fµ %9.1fµ %9.1fµ %9.1fµ %9.1fµ %8.1f %6d\n",
+				r.Key(), r.IndexBuildMs, r.IndexEntries, r.Cold.P50Us, r.Cold.P99Us, r.Warm.P50Us, r.Warm.P90Us, r.Warm.P99Us, r.AllocsPerLookup, r.Wrong+r.Errors)
+		}
+		for _, reg := range out.Regressions {
+			fmt.Fprintf(w, "REGRESSION %s %s: %.1f → %.1f\n", reg.Case, reg.Metric, reg.Baseline, reg.Current)
+		}
+	})
+	for _, r := range report.Results {
+		if r.Wrong > 0 || r.Errors > 0 {
+			return ExitFailed
+		}
+	}
+	if len(out.Regressions) > 0 {
+		return ExitFailed
+	}
+	return ExitOK
+}
+
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func parseInts(s string) ([]int, error) {
+	var ints []int
+	for _, item := range splitList(s) {
+		n, err := strconv.Atoi(item)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a number", item)
+		}
+		ints = append(ints, n)
+	}
+	return ints, nil
+}
+
+func joinInts(ints []int) string {
+	items := make([]string, len(ints))
+	for i, n := range ints {
+		items[i] = strconv.Itoa(n)
+	}
+	return strings.Join(items, ",")
+}
@@ -0,0 +1,109 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/dekanayake/kart-challenge/backend-challenge/internal/repository"
+)
+
+// catalogProduct is a product as GET /api/product returns it.
+type catalogProduct struct {
+	ID       string  `json:"id"`
+	Name     string  `json:"name"`
+	Price    float64 `json:"price"`
+	Category string  `json:"category"`
+}
+
+type catalogResult struct {
+	Source   string   `json:"source"`
+	Products int      `json:"products"`
+	Valid    bool     `json:"valid"`
+	Errors   []string `json:"errors"`
+}
+
+// runCatalogValidate checks the catalog the service serves, or a JSON file of products in the
+// format of GET /api/product.
+func runCatalogValidate(c *cmdContext, args []string) int {
+	fs := c.flagSet()
+	file := fs.String("file", "", "JSON file holding an array of products, the built-in catalog when empty")
+	if code, ok := c.parse(args, 0, 0); !ok {
+		return code
+	}
+
+	result := catalogResult{Source: "built-in", Errors: []string{}}
+	var products []repository.Product
+	if *file != "" {
+		result.Source = *file
+		data, err := os.ReadFile(*file)
+		if err != nil {
+			return c.fail(err)
+		}
+		var listed []catalogProduct
+		if err := json.Unmarshal(data, &listed); err != nil {
+			return c.fail(fmt.Errorf("%s: %w", *file, err))
+		}
+		for _, p := range listed {
+			products = append(products, repository.Product{
+				ID:       p.ID,
+				Name:     p.Name,
+				Price:    repository.ProductPrice{Price: p.Price},
+				Category: repository.Category{Name: p.Category},
+			})
+		}
+	} else {
+		all, err := builtinProducts()
+		if err != nil {
+			return c.fail(err)
+		}
+		products = all
+	}
+
+	result.Products = len(products)
+	if err := repository.ValidateProducts(products); err != nil {
+		var joined interface{ Unwrap() []error }
+		if errors.As(err, &joined) {
+			for _, e := range joined.Unwrap() {
+				result.Errors = append(result.Errors, e.Error())
+			}
+		} else {
+			result.Errors = append(result.Errors, err.Error())
+		}
+	}
+	result.Valid = len(result.Errors) == 0
+
+	c.print(result, func(w io.Writer) {
+		status := "valid"
+		if !result.Valid {
+			status = "INVALID"
+		}
+		fmt.Fprintf(w, "%s catalog: %d products, %s\n", result.Source, result.Products, status)
+		for _, e := range result.Errors {
+			fmt.Fprintf(w, "  %s\n", e)
+		}
+	})
+	if !result.Valid {
+		return ExitFailed
+	}
+	return ExitOK
+}
+
+// builtinProducts pages through the product repository of the service.
+func builtinProducts() ([]repository.Product, error) {
+	repo := repository.GetProductRepository()
+	var products []repository.Product
+	for page := 1; ; page++ {
+		result, err := repo.ListProducts(context.Background(), page, 100)
+		if err != nil {
+			return nil, err
+		}
+		products = append(products, result.Items...)
+		if len(result.Items) == 0 || len(products) >= result.Total {
+			return products, nil
+		}
+	}
+}
@@ -0,0 +1,171 @@
+// Package cli implements kartctl, the command line tool for the operational tasks that do not need a
+// running server: sorting, verifying and indexing coupon files, looking coupons up in local files,
+// validating the product catalog, exporting orders from the service logs, generating
+// synthetic coupon files and benchmarking the coupon readers.
+//
+// Every command takes its flags before its arguments and accepts -json, which prints one JSON
+// document to stdout instead of text. Errors are printed to stderr. The exit code is ExitOK, ExitFailed
+// when the command ran and found a problem, like an unsorted file or an invalid coupon, or ExitError
+// when it could not run.
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dekanayake/kart-challenge/backend-challenge/internal/config"
+	"github.com/rs/zerolog"
+)
+
+const (
+	ExitOK = 0
+	// ExitFailed is a command that ran but found a problem.
+	ExitFailed = 1
+	// ExitError is a command that could not run, because of its usage or an unreadable file.
+	ExitError = 2
+)
+
+type command struct {
+	name    string
+	args    string
+	summary string
+	run     func(c *cmdContext, args []string) int
+}
+
+var commands = []command{
+	{"sort", "[flags] <input> <output>", "external sort a coupon file, optionally normalized and block-gzip compressed", runSort},
+	{"verify", "[flags] <file or folder>...", "check coupon files are sorted and well formed", runVerify},
+	{"index build", "[flags] <file or folder>...", "build the partial index of coupon files and report it", runIndexBuild},
+	{"index inspect", "[flags] <file>...", "print the partial index entries of coupon files", runIndexInspect},
+	{"index btree", "[flags] <file or folder>...", "write the multi-level on-disk index of coupon files for the btree reader", runIndexBTree},
+	{"coupon lookup", "[flags] <code>...", "look coupon codes up in the local coupon files, like the service does", runCouponLookup},
+	{"coupon precompute", "[flags] -o <output> <file or folder>...", "write the valid coupons file the precomputed reader serves", runCouponPrecompute},
+	{"catalog validate", "[flags]", "check the product catalog", runCatalogValidate},
+	{"dataset generate", "[flags] <folder>", "write seeded synthetic coupon files and a manifest of their codes", runDatasetGenerate},
+	{"bench", "[flags] [dataset folder]", "benchmark the coupon readers over a generated dataset", runBench},
+	{"order export", "[flags] <log file or folder>...", "export the orders recorded in JSON service logs", runOrderExport},
+}
+
+// Run runs the command named by the first one or two args and returns the exit code.
+func Run(args []string, stdout, stderr io.Writer) int {
+	// the readers log through the service logger, keep it to warnings on stderr
+	config.Logger = zerolog.New(zerolog.ConsoleWriter{Out: stderr}).Level(zerolog.WarnLevel).With().Timestamp().Logger()
+	// and through config.LoggerFrom, which falls back to the context logger
+	zerolog.DefaultContextLogger = &config.Logger
+
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		w := stdout
+		code := ExitOK
+		if len(args) == 0 {
+			w, code = stderr, ExitError
+		}
+		usage(w)
+		return code
+	}
+
+	for _, cmd := range commands {
+		words := strings.Fields(cmd.name)
+		if len(args) >= len(words) && strings.Join(args[:len(words)], " ") == cmd.name {
+			c := &cmdContext{cmd: cmd, stdout: stdout, stderr: stderr}
+			return cmd.run(c, args[len(words):])
+		}
+	}
+	fmt.Fprintf(stderr, "kartctl: unknown command %q\n\n", strings.Join(args[:min(2, len(args))], " "))
+	usage(stderr)
+	return ExitError
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintf(w, "Usage: kartctl <command> [flags] [args]\n\nCommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-18s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintf(w, "\nRun kartctl <command> -h for the flags of a command. Every command accepts -json.\n")
+	fmt.Fprintf(w, "Exit codes: %d ok, %d a problem was found, %d the command could not run.\n", ExitOK, ExitFailed, ExitError)
+}
+
+// cmdContext is the state of one command run.
+type cmdContext struct {
+	cmd    command
+	stdout io.Writer
+	stderr io.Writer
+	flags  *flag.FlagSet
+	json   bool
+}
+
+// flagSet returns the flags of the command, with -json already registered.
+func (c *cmdContext) flagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet("kartctl "+c.cmd.name, flag.ContinueOnError)
+	fs.SetOutput(c.stderr)
+	fs.BoolVar(&c.json, "json", false, "print the result as JSON")
+	fs.Usage = func() {
+		fmt.Fprintf(c.stderr, "Usage: kartctl %s %s\n\n%s.\n\nFlags:\n", c.cmd.name, c.cmd.args, c.cmd.summary)
+		fs.PrintDefaults()
+	}
+	c.flags = fs
+	return fs
+}
+
+// parse parses args with the flags of the command and checks the number of arguments left. When
+// it returns false the command should exit with the returned code.
+func (c *cmdContext) parse(args []string, minArgs, maxArgs int) (int, bool) {
+	if err := c.flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return ExitOK, false
+		}
+		return ExitError, false
+	}
+	if n := c.flags.NArg(); n < minArgs || (maxArgs >= 0 && n > maxArgs) {
+		c.flags.Usage()
+		return ExitError, false
+	}
+	return ExitOK, true
+}
+
+// print writes v as JSON with -json, otherwise it calls text.
+func (c *cmdContext) print(v any, text func(w io.Writer)) {
+	if !c.json {
+		text(c.stdout)
+		return
+	}
+	enc := json.NewEncoder(c.stdout)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(v)
+}
+
+// fail reports an error that kept the command from running.
+func (c *cmdContext) fail(err error) int {
+	fmt.Fprintf(c.stderr, "kartctl %s: %v\n", c.cmd.name, err)
+	return ExitError
+}
+
+// couponFiles expands folders in args to the couponbase* files inside them, like the HDD reader
+// finds them. Files are kept as they are.
+func couponFiles(args []string) ([]string, error) {
+	var files []string
+	for _, arg := range args {
+		info, err := os.Stat(arg)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, arg)
+			continue
+		}
+		found, err := filepath.Glob(filepath.Join(arg, "couponbase*"))
+		if err != nil {
+			return nil, err
+		}
+		if len(found) == 0 {
+			return nil, fmt.Errorf("no coupon files found in %s", arg)
+		}
+		files = append(files, found...)
+	}
+	return files, nil
+}
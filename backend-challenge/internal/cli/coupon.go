@@ -0,0 +1,172 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dekanayake/kart-challenge/backend-challenge/internal/blockgz"
+	"github.com/dekanayake/kart-challenge/backend-challenge/internal/config"
+	"github.com/dekanayake/kart-challenge/backend-challenge/internal/reader"
+	"github.com/dekanayake/kart-challenge/backend-challenge/internal/validset"
+)
+
+// runCouponLookup loads the service configuration, from the -config file, the environment and the
+// flags, builds the configured reader over the local files and explains the decision on every code.
+func runCouponLookup(c *cmdContext, args []string) int {
+	fs := c.flagSet()
+	configFile := fs.String("config", "", "service config file, the environment and "+config.ConfigFileEnv+" apply as for the service")
+	folder := fs.String("folder", "", "coupon folder, overrides coupon.folder_path")
+	readerType := fs.String("reader-type", "", "hdd, precomputed or btree, overrides coupon.reader_type")
+	if code, ok := c.parse(args, 1, -1); !ok {
+		return code
+	}
+
+	var configArgs []string
+	if *configFile != "" {
+		configArgs = append(configArgs, "--config", *configFile)
+	}
+	if *folder != "" {
+		configArgs = append(configArgs, "--coupon.folder_path", *folder)
+	}
+	if *readerType != "" {
+		configArgs = append(configArgs, "--coupon.reader_type", *readerType)
+	}
+	if _, err := config.LoadConfig(configArgs); err != nil {
+		return c.fail(fmt.Errorf("invalid configuration:\n%w", err))
+	}
+	opts, err := reader.ConfigOptions(config.AppConfig.Coupon)
+	if err != nil {
+		return c.fail(err)
+	}
+	// a lookup from the command line waits for the indexes however long they take
+	opts.PendingMode = reader.PendingWait
+	opts.PendingWaitTimeout = 24 * time.Hour
+	fileReader, err := reader.GetFileReader(config.AppConfig.Coupon.ReaderType, opts)
+	if err != nil {
+		return c.fail(err)
+	}
+
+	code := ExitOK
+	explanations := make([]reader.Explanation, 0, fs.NArg())
+	for _, promo := range fs.Args() {
+		explanation, err := fileReader.ExplainPromo(context.Background(), promo)
+		if err != nil {
+			return c.fail(fmt.Errorf("%s: %w", promo, err))
+		}
+		if !explanation.Valid {
+			code = ExitFailed
+		}
+		explanations = append(explanations, explanation)
+	}
+
+	c.print(explanations, func(w io.Writer) {
+		for _, e := range explanations {
+			if !e.Valid {
+				fmt.Fprintf(w, "%s: invalid, %s\n", e.Code, e.Reason)
+				continue
+			}
+			fmt.Fprintf(w, "%s: valid, found in %s\n", e.Code, strings.Join(e.Matched, ", "))
+			if e.Record != nil && e.Record.HasAttributes() {
+				record, _ := json.Marshal(e.Record)
+				fmt.Fprintf(w, "  record: %s\n", record)
+			}
+		}
+	})
+	return code
+}
+
+type precomputeResult struct {
+	Output string `json:"output"`
+	validset.Stats
+}
+
+// runCouponPrecompute writes the codes the file rules accept to one sorted file, for the precomputed reader.
+func runCouponPrecompute(c *cmdContext, args []string) int {
+	fs := c.flagSet()
+	output := fs.String("o", "", "path of the valid coupons file to write")
+	minFiles := fs.Int("min-files", 2, "files a code must be found in")
+	required := fs.String("required-files", "", "comma separated coupon file names a code must be found in")
+	blockGzip := fs.Bool("block-gzip", false, "write the output as block-gzip")
+	blockSize := fs.Int("block-size", blockgz.DefaultBlockSize, "uncompressed bytes per block with -block-gzip")
+	if code, ok := c.parse(args, 1, -1); !ok {
+		return code
+	}
+	if *output == "" {
+		c.flags.Usage()
+		return ExitError
+	}
+
+	rules := reader.RulePolicy{MinFileMatches: *minFiles, RequiredFiles: splitList(*required)}
+	if rules.MinFileMatches <= 0 && len(rules.RequiredFiles) == 0 {
+		return c.fail(fmt.Errorf("-min-files must be greater than 0 when there are no -required-files"))
+	}
+	if *blockGzip && *blockSize <= 0 {
+		return c.fail(fmt.Errorf("-block-size must be greater than 0"))
+	}
+	policy, err := reader.NewRulePolicy(rules)
+	if err != nil {
+		return c.fail(err)
+	}
+	files, err := couponFiles(fs.Args())
+	if err != nil {
+		return c.fail(err)
+	}
+
+	if !*blockGzip {
+		*blockSize = 0
+	}
+	stats, err := writeValidCoupons(files, *output, policy, *blockSize)
+	if err != nil {
+		return c.fail(err)
+	}
+
+	c.print(precomputeResult{Output: *output, Stats: stats}, func(w io.Writer) {
+		for _, path := range files {
+			fmt.Fprintf(w, "%s: %d lines\n", path, stats.Files[filepath.Base(path)])
+		}
+		fmt.Fprintf(w, "Valid coupons: %d of %d distinct codes written to %s\n", stats.Valid, stats.Codes, *output)
+	})
+	return ExitOK
+}
+
+// writeValidCoupons writes next to the output and renames it into place, so a reader never sees
+// a partly written file. A blockSize greater than 0 writes block-gzip.
+func writeValidCoupons(paths []string, output string, policy reader.Policy, blockSize int) (validset.Stats, error) {
+	tmp, err := os.CreateTemp(filepath.Dir(output), filepath.Base(output)+".*.tmp")
+	if err != nil {
+		return validset.Stats{}, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	buffered := bufio.NewWriter(tmp)
+	var w io.Writer = buffered
+	var blocks *blockgz.Writer
+	if blockSize > 0 {
+		blocks = blockgz.NewWriter(buffered, blockSize)
+		w = blocks
+	}
+	stats, err := validset.Build(paths, w, policy)
+	if err != nil {
+		return stats, err
+	}
+	if blocks != nil {
+		if err := blocks.Close(); err != nil {
+			return stats, err
+		}
+	}
+	if err := buffered.Flush(); err != nil {
+		return stats, err
+	}
+	if err := tmp.Close(); err != nil {
+		return stats, err
+	}
+	return stats, os.Rename(tmp.Name(), output)
+}
@@ -0,0 +1,53 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+
+	"github.com/dekanayake/kart-challenge/backend-challenge/internal/blockgz"
+	"github.com/dekanayake/kart-challenge/backend-challenge/internal/dataset"
+)
+
+// runDatasetGenerate writes synthetic coupon files and their manifest to the folder.
+func runDatasetGenerate(c *cmdContext, args []string) int {
+	opts := dataset.DefaultOptions()
+	fs := c.flagSet()
+	fs.Int64Var(&opts.Seed, "seed", opts.Seed, "seed of the random codes, the same seed gives the same files")
+	fs.IntVar(&opts.Files, "files", opts.Files, "coupon files to write")
+	fs.IntVar(&opts.Codes, "codes", opts.Codes, "codes per file, 0 works it out from -size")
+	fs.Int64Var(&opts.FileSize, "size", 0, "approximate bytes per file, used when -codes is 0")
+	fs.IntVar(&opts.MinLength, "min-length", opts.MinLength, "shortest code")
+	fs.IntVar(&opts.MaxLength, "max-length", opts.MaxLength, "longest code")
+	fs.StringVar(&opts.Charset, "charset", opts.Charset, "characters of the codes")
+	fs.Float64Var(&opts.Overlap, "overlap", opts.Overlap, "share of the codes of each file that are also in other files, 0 to 1")
+	fs.IntVar(&opts.MinFiles, "min-files", opts.MinFiles, "files a code must be in to be listed as valid in the manifest")
+	fs.BoolVar(&opts.Unsorted, "unsorted", false, "leave the lines in the random order they are drawn in, to exercise kartctl sort")
+	blockGzip := fs.Bool("block-gzip", false, "write the files as block-gzip")
+	blockSize := fs.Int("block-size", blockgz.DefaultBlockSize, "uncompressed bytes per block with -block-gzip")
+	fs.IntVar(&opts.Samples, "samples", opts.Samples, "valid, invalid and absent codes listed in the manifest")
+	if code, ok := c.parse(args, 1, 1); !ok {
+		return code
+	}
+	if *blockGzip {
+		if *blockSize <= 0 {
+			return c.fail(fmt.Errorf("-block-size must be greater than 0"))
+		}
+		opts.BlockSize = *blockSize
+	}
+
+	dir := fs.Arg(0)
+	manifest, err := dataset.Generate(dir, opts)
+	if err != nil {
+		return c.fail(err)
+	}
+
+	c.print(manifest, func(w io.Writer) {
+		for _, f := range manifest.Files {
+			fmt.Fprintf(w, "%s: %d codes, %d bytes\n", filepath.Join(dir, f.Name), f.Codes, f.Bytes)
+		}
+		fmt.Fprintf(w, "%d distinct codes, %d in %d or more files, %d in fewer, manifest written to %s\n",
+			manifest.Distinct, manifest.ValidCount, opts.MinFiles, manifest.InvalidCount, filepath.Join(dir, dataset.ManifestFile))
+	})
+	return ExitOK
+}
@@ -0,0 +1,211 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/dekanayake/kart-challenge/backend-challenge/internal/btree"
+	"github.com/dekanayake/kart-challenge/backend-challenge/internal/config"
+	"github.com/dekanayake/kart-challenge/backend-challenge/internal/reader"
+)
+
+// runIndexBuild builds the index of every file the way the service does at startup and reports
+// them like GET /api/admin/coupon-indexes. A file that fails to build, e.g. an unsorted file in
+// strict mode, is a failure.
+func runIndexBuild(c *cmdContext, args []string) int {
+	fs := c.flagSet()
+	opts := indexFlags(fs)
+	fs.BoolVar(&opts.Strict, "strict", false, "fail files that are not sorted, like COUPON_STRICT_VERIFY")
+	if code, ok := c.parse(args, 1, -1); !ok {
+		return code
+	}
+	if err := validateIndexOptions(opts); err != nil {
+		return c.fail(err)
+	}
+	files, err := couponFiles(fs.Args())
+	if err != nil {
+		return c.fail(err)
+	}
+
+	code := ExitOK
+	infos := make([]reader.IndexInfo, 0, len(files))
+	for _, path := range files {
+		info, _, err := reader.BuildIndex(path, *opts)
+		if err != nil {
+			code = ExitFailed
+		}
+		infos = append(infos, info)
+	}
+
+	c.print(infos, func(w io.Writer) {
+		for _, info := range infos {
+			printIndexInfo(w, info)
+		}
+	})
+	return code
+}
+
+type indexInspection struct {
+	reader.IndexInfo
+	Entries []reader.IndexEntry `json:"entries"`
+	// Truncated is set when there are more entries than -limit.
+	Truncated bool `json:"truncated"`
+}
+
+// runIndexInspect builds the index of every file and prints its entries, the first code of each
+// chunk or block and its offset.
+func runIndexInspect(c *cmdContext, args []string) int {
+	fs := c.flagSet()
+	opts := indexFlags(fs)
+	limit := fs.Int("limit", 50, "entries printed per file, 0 prints all of them")
+	if code, ok := c.parse(args, 1, -1); !ok {
+		return code
+	}
+	if err := validateIndexOptions(opts); err != nil {
+		return c.fail(err)
+	}
+	files, err := couponFiles(fs.Args())
+	if err != nil {
+		return c.fail(err)
+	}
+
+	inspections := make([]indexInspection, 0, len(files))
+	for _, path := range files {
+		info, entries, err := reader.BuildIndex(path, *opts)
+		if err != nil {
+			return c.fail(err)
+		}
+		inspection := indexInspection{IndexInfo: info, Entries: entries}
+		if *limit > 0 && len(entries) > *limit {
+			inspection.Entries = entries[:*limit]
+			inspection.Truncated = true
+		}
+		inspections = append(inspections, inspection)
+	}
+
+	c.print(inspections, func(w io.Writer) {
+		for _, inspection := range inspections {
+			printIndexInfo(w, inspection.IndexInfo)
+			fmt.Fprintf(w, "  %12s  %s\n", "offset", "key")
+			for _, entry := range inspection.Entries {
+				fmt.Fprintf(w, "  %12d  %s\n", entry.Offset, entry.Key)
+			}
+			if inspection.Truncated {
+				fmt.Fprintf(w, "  ... %d more entries, see -limit\n", inspection.IndexEntries-len(inspection.Entries))
+			}
+		}
+	})
+	return ExitOK
+}
+
+type btreeResult struct {
+	Path  string `json:"path"`
+	Index string `json:"index"`
+	btree.Info
+	Error string `json:"error,omitempty"`
+}
+
+// runIndexBTree writes the multi-level on-disk index of every file, to btree/<file>.btree next to
+// it, for the btree reader. A file that is not sorted is a failure.
+func runIndexBTree(c *cmdContext, args []string) int {
+	fs := c.flagSet()
+	opts := btreeFlags(fs, "")
+	if code, ok := c.parse(args, 1, -1); !ok {
+		return code
+	}
+	if err := opts.Validate(); err != nil {
+		return c.fail(err)
+	}
+	files, err := couponFiles(fs.Args())
+	if err != nil {
+		return c.fail(err)
+	}
+
+	code := ExitOK
+	results := make([]btreeResult, 0, len(files))
+	for _, path := range files {
+		result, err := buildBTree(path, *opts)
+		if err != nil {
+			code = ExitFailed
+		}
+		results = append(results, result)
+	}
+
+	c.print(results, func(w io.Writer) {
+		for _, result := range results {
+			printBTreeResult(w, result)
+		}
+	})
+	return code
+}
+
+func btreeFlags(fs *flag.FlagSet, prefix string) *btree.Options {
+	opts := btree.DefaultOptions()
+	fs.IntVar(&opts.PageSize, prefix+"page-size", opts.PageSize, "bytes per index page")
+	fs.Int64Var(&opts.Stride, prefix+"stride", opts.Stride, "bytes between leaf entries of plain files, block-gzip files have one per block")
+	return &opts
+}
+
+func buildBTree(path string, opts btree.Options) (btreeResult, error) {
+	result := btreeResult{Path: path, Index: btree.IndexPath(path)}
+	info, err := btree.Build(path, result.Index, opts)
+	if err != nil {
+		result.Error = err.Error()
+		return result, err
+	}
+	result.Info = info
+	return result, nil
+}
+
+func printBTreeResult(w io.Writer, result btreeResult) {
+	if result.Error != "" {
+		fmt.Fprintf(w, "%s: failed: %s\n", result.Path, result.Error)
+		return
+	}
+	fmt.Fprintf(w, "%s: %s, height %d, %d pages of %d bytes, %d leaf entries, keys %s to %s\n",
+		result.Path, result.Index, result.Height, result.Pages, result.PageSize, result.Entries, result.FirstKey, result.LastKey)
+}
+
+// indexFlags registers the flags spacing the index entries, with the defaults of the service.
+func indexFlags(fs *flag.FlagSet) *reader.Options {
+	defaults := config.Default().Coupon
+	opts := &reader.Options{}
+	fs.StringVar(&opts.StrideMode, "stride", defaults.PartialIndexStride, "spacing of the index entries of plain files: lines, bytes or auto")
+	fs.IntVar(&opts.ChunkSize, "chunk-size", defaults.PartialIndexChunkSize, "lines per index entry with -stride lines")
+	fs.Int64Var(&opts.StrideBytes, "stride-bytes", int64(defaults.PartialIndexStrideBytes), "bytes between index entries with -stride bytes")
+	fs.Int64Var(&opts.IndexMemoryBytes, "memory-bytes", int64(defaults.PartialIndexMemoryBytes), "memory the index entries of a file may take with -stride auto")
+	fs.Int64Var(&opts.LookupReadBytes, "read-bytes", int64(defaults.PartialIndexReadBytes), "bytes a lookup should read at most with -stride auto")
+	return opts
+}
+
+func validateIndexOptions(opts *reader.Options) error {
+	switch opts.StrideMode {
+	case reader.StrideLines, reader.StrideBytes, reader.StrideAuto:
+	default:
+		return fmt.Errorf("-stride must be lines, bytes or auto, got %q", opts.StrideMode)
+	}
+	if opts.ChunkSize <= 0 || opts.StrideBytes <= 0 || opts.IndexMemoryBytes <= 0 || opts.LookupReadBytes <= 0 {
+		return fmt.Errorf("-chunk-size, -stride-bytes, -memory-bytes and -read-bytes must be greater than 0")
+	}
+	return nil
+}
+
+func printIndexInfo(w io.Writer, info reader.IndexInfo) {
+	if info.Error != "" {
+		fmt.Fprintf(w, "%s: %s: %s\n", info.Path, info.State, info.Error)
+		return
+	}
+	stride := fmt.Sprintf("%s stride of %d bytes", info.StrideMode, info.StrideBytes)
+	switch info.StrideMode {
+	case reader.StrideLines:
+		stride = fmt.Sprintf("lines stride of %d lines", info.ChunkSize)
+	case "block":
+		stride = "an entry per block"
+	}
+	if info.TreeHeight > 0 {
+		stride += fmt.Sprintf(", on disk in %d levels of %d pages", info.TreeHeight, info.TreePages)
+	}
+	fmt.Fprintf(w, "%s: %s, %s, %d bytes, %d entries, %s, keys %s to %s, built in %dms\n",
+		info.Path, info.State, info.Format, info.FileSizeBytes, info.IndexEntries, stride, info.FirstKey, info.LastKey, info.BuildDurationMs)
+}
@@ -0,0 +1,217 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/dekanayake/kart-challenge/backend-challenge/internal/repository"
+)
+
+// orderLogMessage is the message the order repository logs every order with.
+const orderLogMessage = "New order created"
+
+// orderLogLine is the part of a JSON log line the export reads.
+type orderLogLine struct {
+	Message    string                 `json:"message"`
+	OrderID    string                 `json:"order_id"`
+	CouponCode string                 `json:"coupon_code"`
+	Items      []repository.OrderItem `json:"items"`
+	CreatedAt  time.Time              `json:"created_at"`
+}
+
+type orderExport struct {
+	Orders []repository.Order `json:"orders"`
+	// SkippedLines are the lines that are not JSON, like console formatted logs.
+	SkippedLines int      `json:"skippedLines"`
+	Files        []string `json:"files"`
+}
+
+// runOrderExport reads the orders the service logged, in LOG_FORMAT=json, and writes them as JSON
+// lines or CSV. Log files rotated and compressed by the service are read as they are.
+func runOrderExport(c *cmdContext, args []string) int {
+	fs := c.flagSet()
+	format := fs.String("format", "jsonl", "jsonl or csv, ignored with -json")
+	output := fs.String("o", "-", "file to write the orders to, - for stdout")
+	since := fs.String("since", "", "only orders created at or after this RFC3339 time")
+	until := fs.String("until", "", "only orders created before this RFC3339 time")
+	if code, ok := c.parse(args, 1, -1); !ok {
+		return code
+	}
+	if *format != "jsonl" && *format != "csv" {
+		return c.fail(fmt.Errorf("-format must be jsonl or csv, got %q", *format))
+	}
+	var from, to time.Time
+	var err error
+	if *since != "" {
+		if from, err = time.Parse(time.RFC3339, *since); err != nil {
+			return c.fail(fmt.Errorf("-since: %w", err))
+		}
+	}
+	if *until != "" {
+		if to, err = time.Parse(time.RFC3339, *until); err != nil {
+			return c.fail(fmt.Errorf("-until: %w", err))
+		}
+	}
+	files, err := logFiles(fs.Args())
+	if err != nil {
+		return c.fail(err)
+	}
+
+	export := orderExport{Orders: []repository.Order{}, Files: files}
+	seen := make(map[string]bool)
+	for _, path := range files {
+		skipped, err := readOrders(path, func(order repository.Order) {
+			if seen[order.ID] || (!from.IsZero() && order.CreatedAt.Before(from)) || (!to.IsZero() && !order.CreatedAt.Before(to)) {
+				return
+			}
+			seen[order.ID] = true
+			export.Orders = append(export.Orders, order)
+		})
+		if err != nil {
+			return c.fail(fmt.Errorf("%s: %w", path, err))
+		}
+		export.SkippedLines += skipped
+	}
+	sort.SliceStable(export.Orders, func(i, j int) bool {
+		return export.Orders[i].CreatedAt.Before(export.Orders[j].CreatedAt)
+	})
+
+	w := c.stdout
+	if *output != "-" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return c.fail(err)
+		}
+		defer f.Close()
+		w = f
+	}
+	if c.json {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(export)
+	} else if *format == "csv" {
+		err = writeOrdersCSV(w, export.Orders)
+	} else {
+		err = writeOrdersJSONL(w, export.Orders)
+	}
+	if err != nil {
+		return c.fail(err)
+	}
+	if f, ok := w.(*os.File); ok && f != os.Stdout {
+		if err := f.Close(); err != nil {
+			return c.fail(err)
+		}
+	}
+	if !c.json {
+		fmt.Fprintf(c.stderr, "Exported %d orders from %d files, %d lines were not JSON\n", len(export.Orders), len(files), export.SkippedLines)
+	}
+	return ExitOK
+}
+
+// logFiles expands folders in args to the log files inside them, including the rotated ones.
+func logFiles(args []string) ([]string, error) {
+	var files []string
+	for _, arg := range args {
+		info, err := os.Stat(arg)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, arg)
+			continue
+		}
+		found, err := filepath.Glob(filepath.Join(arg, "*.log*"))
+		if err != nil {
+			return nil, err
+		}
+		if len(found) == 0 {
+			return nil, fmt.Errorf("no log files found in %s", arg)
+		}
+		files = append(files, found...)
+	}
+	return files, nil
+}
+
+// readOrders calls fn with every order logged in the file and returns the number of lines that
+// are not JSON.
+func readOrders(path string, fn func(repository.Order)) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	br := bufio.NewReader(f)
+	var r io.Reader = br
+	if magic, _ := br.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return 0, err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	skipped := 0
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var entry orderLogLine
+		if err := json.Unmarshal(line, &entry); err != nil {
+			skipped++
+			continue
+		}
+		if entry.Message != orderLogMessage || entry.OrderID == "" {
+			continue
+		}
+		fn(repository.Order{
+			ID:         entry.OrderID,
+			CouponCode: entry.CouponCode,
+			Items:      entry.Items,
+			CreatedAt:  entry.CreatedAt,
+		})
+	}
+	return skipped, scanner.Err()
+}
+
+func writeOrdersJSONL(w io.Writer, orders []repository.Order) error {
+	enc := json.NewEncoder(w)
+	for _, order := range orders {
+		if err := enc.Encode(order); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeOrdersCSV writes one row per order item.
+func writeOrdersCSV(w io.Writer, orders []repository.Order) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"order_id", "created_at", "coupon_code", "product_id", "quantity"}); err != nil {
+		return err
+	}
+	for _, order := range orders {
+		createdAt := order.CreatedAt.Format(time.RFC3339)
+		for _, item := range order.Items {
+			if err := cw.Write([]string{order.ID, createdAt, order.CouponCode, item.ProductId, strconv.Itoa(item.Quantity)}); err != nil {
+				return err
+			}
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,116 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/dekanayake/kart-challenge/backend-challenge/internal/blockgz"
+	"github.com/dekanayake/kart-challenge/backend-challenge/internal/extsort"
+)
+
+type sortResult struct {
+	Input       string        `json:"input"`
+	Output      string        `json:"output"`
+	Stats       extsort.Stats `json:"stats"`
+	InputLines  int           `json:"inputLines"`
+	OutputLines int           `json:"outputLines"`
+	// Error explains the line counts that the stats do not account for.
+	Error string `json:"error,omitempty"`
+	// BTree is the on-disk index written with -btree.
+	BTree *btreeResult `json:"btree,omitempty"`
+}
+
+// runSort sorts the input into the output. A third argument is the chunk size, as the sort utility
+// took it before kartctl.
+func runSort(c *cmdContext, args []string) int {
+	opts := extsort.DefaultOptions()
+	fs := c.flagSet()
+	fs.IntVar(&opts.ChunkSize, "chunk-size", opts.ChunkSize, "bytes of lines sorted in memory at once")
+	fs.IntVar(&opts.Workers, "workers", opts.Workers, "chunks sorted concurrently")
+	fs.IntVar(&opts.MemoryBudget, "memory", opts.MemoryBudget, "bytes of chunks held in memory at once")
+	fs.IntVar(&opts.MaxOpenFiles, "max-open-files", opts.MaxOpenFiles, "sorted files merged in one pass")
+	blockGzip := fs.Bool("block-gzip", false, "write the output as block-gzip")
+	blockSize := fs.Int("block-size", blockgz.DefaultBlockSize, "uncompressed bytes per block with -block-gzip")
+	fs.BoolVar(&opts.Trim, "trim", false, "trim spaces around lines and codes")
+	fs.BoolVar(&opts.FoldCase, "fold-case", false, "upper case the codes")
+	fs.BoolVar(&opts.DropBlank, "drop-blank", false, "drop blank lines")
+	fs.BoolVar(&opts.Dedupe, "dedupe", false, "drop duplicate lines")
+	normalizeAll := fs.Bool("normalize", false, "same as -trim -fold-case -drop-blank -dedupe")
+	withBTree := fs.Bool("btree", false, "also write the multi-level on-disk index of the output, for the btree reader")
+	btreeOpts := btreeFlags(fs, "btree-")
+	if code, ok := c.parse(args, 2, 3); !ok {
+		return code
+	}
+
+	if *normalizeAll {
+		opts.Trim, opts.FoldCase, opts.DropBlank, opts.Dedupe = true, true, true, true
+	}
+	if fs.NArg() > 2 {
+		chunkSize, err := strconv.Atoi(fs.Arg(2))
+		if err != nil {
+			return c.fail(fmt.Errorf("chunk size %q is not a number", fs.Arg(2)))
+		}
+		opts.ChunkSize = chunkSize
+	}
+	if *blockGzip {
+		if *blockSize <= 0 {
+			return c.fail(fmt.Errorf("-block-size must be greater than 0"))
+		}
+		opts.BlockSize = *blockSize
+	}
+	if err := opts.Validate(); err != nil {
+		return c.fail(err)
+	}
+	if *withBTree {
+		if err := btreeOpts.Validate(); err != nil {
+			return c.fail(err)
+		}
+	}
+
+	result := sortResult{Input: fs.Arg(0), Output: fs.Arg(1)}
+	if !c.json {
+		fmt.Fprintf(c.stdout, "Sorting file: %s → %s (chunk size: %d bytes, workers: %d, memory: %d bytes)\n",
+			result.Input, result.Output, opts.ChunkSize, opts.Workers, opts.MemoryBudget)
+	}
+	stats, err := extsort.Sort(result.Input, result.Output, opts)
+	if err != nil {
+		return c.fail(err)
+	}
+	result.Stats = stats
+	if result.InputLines, err = extsort.CountLines(result.Input); err != nil {
+		return c.fail(fmt.Errorf("failed to count input lines: %w", err))
+	}
+	if result.OutputLines, err = extsort.CountLines(result.Output); err != nil {
+		return c.fail(fmt.Errorf("failed to count output lines: %w", err))
+	}
+	mismatch := stats.Reconcile(result.InputLines, result.OutputLines)
+	if mismatch != nil {
+		result.Error = mismatch.Error()
+	}
+	// the output is sorted, its index is written in one more pass over it
+	if *withBTree && mismatch == nil {
+		tree, err := buildBTree(result.Output, *btreeOpts)
+		if err != nil {
+			return c.fail(err)
+		}
+		result.BTree = &tree
+	}
+
+	c.print(result, func(w io.Writer) {
+		stats.Print(w)
+		fmt.Fprintf(w, "Validation: input lines = %d, output lines = %d, dropped = %d blank + %d duplicates\n",
+			result.InputLines, result.OutputLines, stats.BlankDropped, stats.DuplicatesDropped)
+		if mismatch == nil {
+			fmt.Fprintln(w, "Sorting complete and validated successfully!")
+		}
+		if result.BTree != nil {
+			printBTreeResult(w, *result.BTree)
+		}
+	})
+	if mismatch != nil {
+		fmt.Fprintf(c.stderr, "Line count mismatch! Possible data loss during sort:\n%v\n", mismatch)
+		return ExitFailed
+	}
+	return ExitOK
+}
@@ -0,0 +1,63 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/dekanayake/kart-challenge/backend-challenge/internal/verify"
+)
+
+func runVerify(c *cmdContext, args []string) int {
+	var opts verify.Options
+	fs := c.flagSet()
+	fs.StringVar(&opts.Charset, "charset", "", "regular expression character class the codes must match, like A-Z0-9")
+	fs.IntVar(&opts.MaxIssues, "max-issues", 100, "issues listed per file, 0 lists all of them")
+	if code, ok := c.parse(args, 1, -1); !ok {
+		return code
+	}
+	files, err := couponFiles(fs.Args())
+	if err != nil {
+		return c.fail(err)
+	}
+
+	reports := make([]*verify.Report, 0, len(files))
+	for _, path := range files {
+		report, err := verify.File(path, opts)
+		if err != nil {
+			return c.fail(err)
+		}
+		reports = append(reports, report)
+	}
+
+	code := ExitOK
+	for _, report := range reports {
+		if !report.OK() {
+			code = ExitFailed
+		}
+	}
+	c.print(reports, func(w io.Writer) {
+		for _, report := range reports {
+			printReport(w, report)
+		}
+	})
+	return code
+}
+
+func printReport(w io.Writer, r *verify.Report) {
+	status := "sorted"
+	if !r.Sorted {
+		status = "NOT sorted"
+	}
+	fmt.Fprintf(w, "%s: %d lines, %d bytes, %s\n", r.Path, r.Lines, r.Bytes, status)
+	for _, kind := range verify.Kinds {
+		if n := r.Counts[kind]; n > 0 {
+			fmt.Fprintf(w, "  %s: %d\n", kind, n)
+		}
+	}
+	for _, issue := range r.Issues {
+		fmt.Fprintf(w, "  %s\n", issue)
+	}
+	if r.Truncated {
+		fmt.Fprintf(w, "  ... more issues not listed, see -max-issues\n")
+	}
+}
@@ -1,61 +1,307 @@
 package config
 
 import (
-	"fmt"
+	"errors"
+	"flag"
+	"io"
 	"os"
-	"strconv"
 	"strings"
 
 	"github.com/joho/godotenv"
 )
 
+// Config is the service configuration. Every value starts from Default, is overridden by the
+// config file, then by the environment variable in its env tag, and finally by the command line
+// flag named after its yaml path, e.g. --coupon.reader_type=hdd.
 type Config struct {
-	Port                                int
-	LogLevel                            string
-	Enviornment                         string
-	CouponCodeFolderPath                string
-	CouponCodeFilePartialIndexChunkSize int
-	CouponCodeFileConcurrentPoolSize    int
+	Server       ServerConfig       `yaml:"server"`
+	Logging      LoggingConfig      `yaml:"logging"`
+	Coupon       CouponConfig       `yaml:"coupon"`
+	Repositories RepositoriesConfig `yaml:"repositories"`
+	Auth         AuthConfig         `yaml:"auth"`
+	RateLimit    RateLimitConfig    `yaml:"rate_limit"`
+	Metrics      MetricsConfig      `yaml:"metrics"`
+	Tracing      TracingConfig      `yaml:"tracing"`
 }
 
+type ServerConfig struct {
+	Port        int    `yaml:"port" env:"PORT"`
+	Environment string `yaml:"environment" env:"ENVIRONMENT"`
+	// TrustedProxies are the IPs and CIDRs of the proxies whose X-Forwarded-For header names the
+	// client, comma separated in env and flags. Empty trusts none, the client is the peer address.
+	TrustedProxies []string `yaml:"trusted_proxies" env:"SERVER_TRUSTED_PROXIES"`
+}
+
+type LoggingConfig struct {
+	Level  string `yaml:"level" env:"LOG_LEVEL"`
+	Format string `yaml:"format" env:"LOG_FORMAT"`
+	Output string `yaml:"output" env:"LOG_OUTPUT"`
+	// DebugSampleRate keeps only 1 of every N debug events, 1 keeps all of them.
+	DebugSampleRate int             `yaml:"debug_sample_rate" env:"LOG_DEBUG_SAMPLE_RATE"`
+	File            LogFileConfig   `yaml:"file"`
+	Syslog          LogSyslogConfig `yaml:"syslog"`
+}
+
+type LogFileConfig struct {
+	Path       string `yaml:"path" env:"LOG_FILE_PATH"`
+	MaxSizeMB  int    `yaml:"max_size_mb" env:"LOG_FILE_MAX_SIZE_MB"`
+	MaxAgeDays int    `yaml:"max_age_days" env:"LOG_FILE_MAX_AGE_DAYS"`
+	MaxBackups int    `yaml:"max_backups" env:"LOG_FILE_MAX_BACKUPS"`
+}
+
+// LogSyslogConfig selects the syslog daemon, an empty network logs to the local daemon.
+type LogSyslogConfig struct {
+	Network string `yaml:"network" env:"LOG_SYSLOG_NETWORK"`
+	Address string `yaml:"address" env:"LOG_SYSLOG_ADDRESS"`
+}
+
+type CouponConfig struct {
+	// ReaderType is hdd to search the coupon files, precomputed to serve the valid coupons file, or
+	// btree to search the coupon files through their on-disk indexes.
+	ReaderType string `yaml:"reader_type" env:"COUPON_READER_TYPE"`
+	FolderPath string `yaml:"folder_path" env:"COUPON_CODE_FOLDER_PATH"`
+	// ValidCouponsPath is the file the precomputed reader serves, folder_path/valid_coupons when empty.
+	ValidCouponsPath      string `yaml:"valid_coupons_path" env:"COUPON_VALID_COUPONS_PATH"`
+	PartialIndexChunkSize int    `yaml:"partial_index_chunk_size" env:"COUPON_CODE_FILE_PARTIAL_INDEX_CHUNK_SIZE"`
+	// PartialIndexStride spaces the index entries: lines, every partial_index_chunk_size lines, bytes,
+	// every partial_index_stride_bytes bytes, or auto, a byte stride per file that keeps the entries
+	// of all the files within partial_index_memory_bytes and the data a lookup reads from a file
+	// within partial_index_read_bytes where the memory allows it.
+	PartialIndexStride      string `yaml:"partial_index_stride" env:"COUPON_PARTIAL_INDEX_STRIDE"`
+	PartialIndexStrideBytes int    `yaml:"partial_index_stride_bytes" env:"COUPON_PARTIAL_INDEX_STRIDE_BYTES"`
+	PartialIndexMemoryBytes int    `yaml:"partial_index_memory_bytes" env:"COUPON_PARTIAL_INDEX_MEMORY_BYTES"`
+	PartialIndexReadBytes   int    `yaml:"partial_index_read_bytes" env:"COUPON_PARTIAL_INDEX_READ_BYTES"`
+	SearchPoolSize          int    `yaml:"search_pool_size" env:"COUPON_CODE_FILE_CONCURRENT_POOL_SIZE"`
+	IndexBuildConcurrency   int    `yaml:"index_build_concurrency" env:"COUPON_INDEX_BUILD_CONCURRENCY"`
+	// IndexPendingMode decides what lookups made while the indexes are building do, reject or wait.
+	IndexPendingMode        string `yaml:"index_pending_mode" env:"COUPON_INDEX_PENDING_MODE"`
+	IndexPendingWaitSeconds int    `yaml:"index_pending_wait_seconds" env:"COUPON_INDEX_PENDING_WAIT_SECONDS"`
+	IndexRetryAfterSeconds  int    `yaml:"index_retry_after_seconds" env:"COUPON_INDEX_RETRY_AFTER_SECONDS"`
+	// StrictVerify refuses to serve coupon files that are not sorted, checking every line at startup.
+	StrictVerify bool               `yaml:"strict_verify" env:"COUPON_STRICT_VERIFY"`
+	Policy       CouponPolicyConfig `yaml:"policy"`
+	Cache        CouponCacheConfig  `yaml:"cache"`
+}
+
+// CouponPolicyConfig decides which coupon codes are valid.
+type CouponPolicyConfig struct {
+	MinFileMatches int `yaml:"min_file_matches" env:"COUPON_POLICY_MIN_FILE_MATCHES"`
+	// RequiredFiles are coupon file names that must contain the code, comma separated in env and flags.
+	RequiredFiles []string `yaml:"required_files" env:"COUPON_POLICY_REQUIRED_FILES"`
+	MinLength     int      `yaml:"min_length" env:"COUPON_POLICY_MIN_LENGTH"`
+	MaxLength     int      `yaml:"max_length" env:"COUPON_POLICY_MAX_LENGTH"`
+	// Charset is a regular expression character class, like A-Z0-9, empty allows any character.
+	Charset string `yaml:"charset" env:"COUPON_POLICY_CHARSET"`
+	// CaseSensitive false upper cases codes before the lookup.
+	CaseSensitive bool `yaml:"case_sensitive" env:"COUPON_POLICY_CASE_SENSITIVE"`
+}
+
+// CouponCacheConfig keeps the results of recent coupon lookups in memory, valid codes for
+// positive_ttl_seconds and invalid codes for negative_ttl_seconds, 0 does not cache invalid codes.
+type CouponCacheConfig struct {
+	Enabled            bool `yaml:"enabled" env:"COUPON_CACHE_ENABLED"`
+	Size               int  `yaml:"size" env:"COUPON_CACHE_SIZE"`
+	PositiveTTLSeconds int  `yaml:"positive_ttl_seconds" env:"COUPON_CACHE_POSITIVE_TTL_SECONDS"`
+	NegativeTTLSeconds int  `yaml:"negative_ttl_seconds" env:"COUPON_CACHE_NEGATIVE_TTL_SECONDS"`
+}
+
+type RepositoriesConfig struct {
+	Cart CartRepositoryConfig `yaml:"cart"`
+}
+
+type CartRepositoryConfig struct {
+	Type                 string `yaml:"type" env:"CART_REPOSITORY_TYPE"`
+	StorePath            string `yaml:"store_path" env:"CART_STORE_PATH"`
+	InactivityTTLMinutes int    `yaml:"inactivity_ttl_minutes" env:"CART_INACTIVITY_TTL_MINUTES"`
+}
+
+type AuthConfig struct {
+	// AdminAPIKey enables the admin endpoints when set.
+	AdminAPIKey string `yaml:"admin_api_key" env:"ADMIN_API_KEY" secret:"true"`
+}
+
+type RateLimitConfig struct {
+	Enabled bool `yaml:"enabled" env:"RATE_LIMIT_ENABLED"`
+	// APIKeys are the client API keys that get a budget of their own next to the client IP, comma
+	// separated in env and flags. The admin key always does.
+	APIKeys []string         `yaml:"api_keys" env:"RATE_LIMIT_API_KEYS" secret:"true"`
+	Order   OrderRateConfig  `yaml:"order"`
+	Coupon  CouponRateConfig `yaml:"coupon"`
+}
+
+type OrderRateConfig struct {
+	PerMinute int `yaml:"per_minute" env:"RATE_LIMIT_ORDER_PER_MINUTE"`
+	Burst     int `yaml:"burst" env:"RATE_LIMIT_ORDER_BURST"`
+}
+
+type CouponRateConfig struct {
+	PerMinute int `yaml:"per_minute" env:"RATE_LIMIT_COUPON_PER_MINUTE"`
+	Burst     int `yaml:"burst" env:"RATE_LIMIT_COUPON_BURST"`
+	// LockoutThreshold is the number of invalid coupons after which a caller is locked out.
+	LockoutThreshold   int `yaml:"lockout_threshold" env:"COUPON_LOCKOUT_THRESHOLD"`
+	LockoutBaseSeconds int `yaml:"lockout_base_seconds" env:"COUPON_LOCKOUT_BASE_SECONDS"`
+	LockoutMaxSeconds  int `yaml:"lockout_max_seconds" env:"COUPON_LOCKOUT_MAX_SECONDS"`
+}
+
+type MetricsConfig struct {
+	Enabled bool `yaml:"enabled" env:"METRICS_ENABLED"`
+}
+
+type TracingConfig struct {
+	Exporter    string  `yaml:"exporter" env:"TRACING_EXPORTER"`
+	FilePath    string  `yaml:"file_path" env:"TRACING_FILE_PATH"`
+	SampleRatio float64 `yaml:"sample_ratio" env:"TRACING_SAMPLE_RATIO"`
+}
+
+// ConfigFileEnv names the config file when --config is not given.
+const ConfigFileEnv = "CONFIG_FILE"
+
 var AppConfig Config
 
-func LoadConfig() {
-	_ = godotenv.Load()
+// Options are the command line options that control loading rather than a config value.
+type Options struct {
+	ConfigFile  string
+	PrintConfig bool
+}
 
-	AppConfig = Config{
-		Port:                                getEnvInt("PORT", 8080),
-		LogLevel:                            strings.ToLower(getEnvString("LOG_LEVEL", "info")),
-		Enviornment:                         strings.ToLower(getEnvString("ENVIRONMENT", "devlelopment")),
-		CouponCodeFolderPath:                strings.ToLower(mustGetEnv("COUPON_CODE_FOLDER_PATH")),
-		CouponCodeFilePartialIndexChunkSize: getEnvInt("COUPON_CODE_FILE_PARTIAL_INDEX_CHUNK_SIZE", 100000),
-		CouponCodeFileConcurrentPoolSize:    getEnvInt("COUPON_CODE_FILE_CONCURRENT_POOL_SIZE", 5),
+func Default() Config {
+	return Config{
+		Server: ServerConfig{
+			Port:           8080,
+			Environment:    "development",
+			TrustedProxies: []string{},
+		},
+		Logging: LoggingConfig{
+			Level:           "info",
+			Format:          ConsoleLogFormat,
+			Output:          StdoutLogOutput,
+			DebugSampleRate: 1,
+			File: LogFileConfig{
+				Path:       "logs/kart-service.log",
+				MaxSizeMB:  100,
+				MaxAgeDays: 7,
+				MaxBackups: 5,
+			},
+		},
+		Coupon: CouponConfig{
+			ReaderType:              HDDReaderType,
+			PartialIndexChunkSize:   100000,
+			PartialIndexStride:      "lines",
+			PartialIndexStrideBytes: 1 << 20,
+			PartialIndexMemoryBytes: 64 << 20,
+			PartialIndexReadBytes:   128 << 10,
+			SearchPoolSize:          5,
+			IndexBuildConcurrency:   4,
+			IndexPendingMode:        "reject",
+			IndexPendingWaitSeconds: 30,
+			IndexRetryAfterSeconds:  10,
+			Policy: CouponPolicyConfig{
+				MinFileMatches: 2,
+				RequiredFiles:  []string{},
+				MinLength:      8,
+				MaxLength:      10,
+				CaseSensitive:  true,
+			},
+			Cache: CouponCacheConfig{
+				Enabled:            false,
+				Size:               100000,
+				PositiveTTLSeconds: 300,
+				NegativeTTLSeconds: 60,
+			},
+		},
+		Repositories: RepositoriesConfig{
+			Cart: CartRepositoryConfig{
+				Type:                 "memory",
+				StorePath:            "./data/carts",
+				InactivityTTLMinutes: 60,
+			},
+		},
+		RateLimit: RateLimitConfig{
+			Enabled: true,
+			APIKeys: []string{},
+			Order: OrderRateConfig{
+				PerMinute: 30,
+				Burst:     10,
+			},
+			Coupon: CouponRateConfig{
+				PerMinute:          20,
+				Burst:              5,
+				LockoutThreshold:   5,
+				LockoutBaseSeconds: 30,
+				LockoutMaxSeconds:  3600,
+			},
+		},
+		Metrics: MetricsConfig{
+			Enabled: true,
+		},
+		Tracing: TracingConfig{
+			Exporter:    "none",
+			FilePath:    "traces.json",
+			SampleRatio: 1,
+		},
 	}
 }
 
-func getEnvString(key, defaultValue string) string {
-	if val, ok := os.LookupEnv(key); ok {
-		return val
+// LoadConfig layers the config file, the environment and the command line flags in args over the
+// defaults and validates the result. Every problem found is reported in the returned error, and
+// AppConfig is set even when there are problems so --print-config can still show it.
+func LoadConfig(args []string) (Options, error) {
+	_ = godotenv.Load()
+
+	cfg := Default()
+	opts, overrides, err := parseFlags(args, &cfg)
+	if err != nil {
+		return opts, err
+	}
+	if opts.ConfigFile == "" {
+		opts.ConfigFile = os.Getenv(ConfigFileEnv)
 	}
-	return defaultValue
-}
 
-func getEnvInt(key string, defaultValue int) int {
-	if val, ok := os.LookupEnv(key); ok {
-		i, err := strconv.Atoi(val)
-		if err != nil {
-			fmt.Printf("Error in convertng the %s env variable to int: %v\n", key, err)
-			return defaultValue
+	var errs []error
+	if opts.ConfigFile != "" {
+		if err := loadFile(opts.ConfigFile, &cfg); err != nil {
+			errs = append(errs, err)
 		}
-		return i
 	}
-	return defaultValue
+	errs = append(errs, applyEnv(&cfg, os.LookupEnv))
+	errs = append(errs, applyFlags(&cfg, overrides))
+
+	cfg.normalize()
+	errs = append(errs, cfg.Validate())
+
+	AppConfig = cfg
+	return opts, errors.Join(errs...)
 }
 
-func mustGetEnv(key string) string {
-	if val, ok := os.LookupEnv(key); ok {
-		return val
-	} else {
-		panic(fmt.Sprintf("required environment variable %s not set", key))
+// normalize lowercases the values that are compared against a fixed set of names. Paths keep their case.
+func (c *Config) normalize() {
+	for _, s := range []*string{
+		&c.Server.Environment,
+		&c.Logging.Level,
+		&c.Logging.Format,
+		&c.Logging.Output,
+		&c.Logging.Syslog.Network,
+		&c.Coupon.ReaderType,
+		&c.Coupon.IndexPendingMode,
+		&c.Coupon.PartialIndexStride,
+		&c.Repositories.Cart.Type,
+		&c.Tracing.Exporter,
+	} {
+		*s = strings.ToLower(strings.TrimSpace(*s))
 	}
 }
+
+// PrintConfig writes the configuration as YAML with the secrets redacted.
+func PrintConfig(w io.Writer, cfg Config) error {
+	out, err := marshalYAML(cfg.Redacted())
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(out)
+	return err
+}
+
+// IsHelp reports whether LoadConfig failed because -h or --help was given.
+func IsHelp(err error) bool {
+	return errors.Is(err, flag.ErrHelp)
+}
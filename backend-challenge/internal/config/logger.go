@@ -1,38 +1,121 @@
 package config
 
 import (
+	"context"
+	"fmt"
+	"io"
 	"os"
 	"time"
 
 	"github.com/rs/zerolog"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+const (
+	ConsoleLogFormat = "console"
+	JSONLogFormat    = "json"
+
+	StdoutLogOutput = "stdout"
+	FileLogOutput   = "file"
+	SyslogLogOutput = "syslog"
 )
 
 var Logger zerolog.Logger
 
-func InitLogger() {
-	var level zerolog.Level
-	switch AppConfig.LogLevel {
+// InitLogger builds the service logger from the logging configuration. The level is applied as
+// the zerolog global level, so it can be changed at runtime with SetLogLevel.
+func InitLogger() error {
+	zerolog.SetGlobalLevel(levelOrDefault(AppConfig.Logging.Level))
+
+	output, err := logOutput()
+	if err != nil {
+		return err
+	}
+
+	logger := zerolog.New(output).
+		With().
+		Timestamp().
+		Str("service", "kart-service").
+		Logger()
+
+	// debug logging in the coupon search writes several events per request, sample them when asked to
+	if AppConfig.Logging.DebugSampleRate > 1 {
+		logger = logger.Sample(zerolog.LevelSampler{
+			DebugSampler: &zerolog.BasicSampler{N: uint32(AppConfig.Logging.DebugSampleRate)},
+		})
+	}
+	Logger = logger
+
+	// loggers taken from a context without a request logger fall back to the service logger
+	zerolog.DefaultContextLogger = &Logger
+	return nil
+}
+
+// LoggerFrom returns the request scoped logger stored in ctx by the request id middleware,
+// or the service logger when there is none.
+func LoggerFrom(ctx context.Context) *zerolog.Logger {
+	return zerolog.Ctx(ctx)
+}
+
+// SetLogLevel changes the level of every logger at runtime.
+func SetLogLevel(level string) error {
+	parsed, err := zerolog.ParseLevel(level)
+	if err != nil || level == "" {
+		return fmt.Errorf("invalid log level: %q", level)
+	}
+	zerolog.SetGlobalLevel(parsed)
+	return nil
+}
+
+func CurrentLogLevel() string {
+	return zerolog.GlobalLevel().String()
+}
+
+func levelOrDefault(level string) zerolog.Level {
+	switch level {
 	case "debug":
-		level = zerolog.DebugLevel
+		return zerolog.DebugLevel
 	case "warn":
-		level = zerolog.WarnLevel
+		return zerolog.WarnLevel
 	case "error":
-		level = zerolog.ErrorLevel
+		return zerolog.ErrorLevel
 	case "fatal":
-		level = zerolog.FatalLevel
+		return zerolog.FatalLevel
 	default:
-		level = zerolog.InfoLevel
+		return zerolog.InfoLevel
 	}
+}
 
-	output := zerolog.ConsoleWriter{
-		Out:        os.Stdout,
-		TimeFormat: time.RFC3339,
+func logOutput() (io.Writer, error) {
+	var out io.Writer
+	switch AppConfig.Logging.Output {
+	case StdoutLogOutput:
+		out = os.Stdout
+	case FileLogOutput:
+		out = &lumberjack.Logger{
+			Filename:   AppConfig.Logging.File.Path,
+			MaxSize:    AppConfig.Logging.File.MaxSizeMB,
+			MaxAge:     AppConfig.Logging.File.MaxAgeDays,
+			MaxBackups: AppConfig.Logging.File.MaxBackups,
+			Compress:   true,
+		}
+	case SyslogLogOutput:
+		// syslog has its own framing and timestamps, the format setting does not apply
+		return newSyslogWriter(AppConfig.Logging.Syslog.Network, AppConfig.Logging.Syslog.Address)
+	default:
+		return nil, fmt.Errorf("unsupported log output: %s", AppConfig.Logging.Output)
 	}
 
-	Logger = zerolog.New(output).
-		Level(level).
-		With().
-		Timestamp().
-		Str("service", "kart-service").
-		Logger()
+	switch AppConfig.Logging.Format {
+	case JSONLogFormat:
+		return out, nil
+	case ConsoleLogFormat:
+		return zerolog.ConsoleWriter{
+			Out:        out,
+			TimeFormat: time.RFC3339,
+			NoColor:    AppConfig.Logging.Output != StdoutLogOutput,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported log format: %s", AppConfig.Logging.Format)
+	}
 }
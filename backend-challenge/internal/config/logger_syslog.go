@@ -0,0 +1,19 @@
+//go:build !windows
+
+package config
+
+import (
+	"io"
+	"log/syslog"
+
+	"github.com/rs/zerolog"
+)
+
+// newSyslogWriter connects to the syslog daemon, to the local one when address is empty.
+func newSyslogWriter(network, address string) (io.Writer, error) {
+	w, err := syslog.Dial(network, address, syslog.LOG_INFO|syslog.LOG_DAEMON, "kart-service")
+	if err != nil {
+		return nil, err
+	}
+	return zerolog.SyslogLevelWriter(w), nil
+}
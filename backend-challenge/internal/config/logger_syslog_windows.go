@@ -0,0 +1,12 @@
+//go:build windows
+
+package config
+
+import (
+	"errors"
+	"io"
+)
+
+func newSyslogWriter(network, address string) (io.Writer, error) {
+	return nil, errors.New("syslog log output is not supported on windows")
+}
@@ -0,0 +1,251 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+	"github.com/pelletier/go-toml/v2"
+)
+
+const redacted = "********"
+
+// field is a single config value, addressed by its dotted yaml path.
+type field struct {
+	path   string
+	env    string
+	secret bool
+	value  reflect.Value
+}
+
+type override struct {
+	path  string
+	value string
+}
+
+func fields(cfg *Config) []field {
+	return collectFields(reflect.ValueOf(cfg).Elem(), "")
+}
+
+func collectFields(v reflect.Value, prefix string) []field {
+	var out []field
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		path := prefix + sf.Tag.Get("yaml")
+		if sf.Type.Kind() == reflect.Struct {
+			out = append(out, collectFields(v.Field(i), path+".")...)
+			continue
+		}
+		out = append(out, field{
+			path:   path,
+			env:    sf.Tag.Get("env"),
+			secret: sf.Tag.Get("secret") == "true",
+			value:  v.Field(i),
+		})
+	}
+	return out
+}
+
+func setValue(v reflect.Value, raw string) error {
+	raw = strings.TrimSpace(raw)
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Int:
+		i, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("%q is not an integer", raw)
+		}
+		v.SetInt(int64(i))
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("%q is not a boolean", raw)
+		}
+		v.SetBool(b)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", raw)
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		// string lists are comma separated
+		list := []string{}
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		v.Set(reflect.ValueOf(list))
+	default:
+		return fmt.Errorf("unsupported config value type %s", v.Kind())
+	}
+	return nil
+}
+
+// loadFile reads a YAML or TOML config file over cfg. Unknown keys are errors, so typos do not go unnoticed.
+func loadFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config file: %w", err)
+	}
+
+	isTOML := false
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+	case ".toml":
+		isTOML = true
+		// decode TOML through YAML so both formats share the yaml keys and the strict decoding
+		var doc map[string]any
+		if err := toml.Unmarshal(data, &doc); err != nil {
+			return fmt.Errorf("config file %s: %w", path, err)
+		}
+		if data, err = yaml.Marshal(doc); err != nil {
+			return fmt.Errorf("config file %s: %w", path, err)
+		}
+	default:
+		return fmt.Errorf("config file %s: unsupported extension, use .yaml, .yml or .toml", path)
+	}
+
+	if err := yaml.UnmarshalWithOptions(data, cfg, yaml.Strict()); err != nil {
+		// the source excerpt of a TOML file is the converted YAML, which would only confuse
+		return fmt.Errorf("config file %s: %s", path, yaml.FormatError(err, false, !isTOML))
+	}
+	return nil
+}
+
+func applyEnv(cfg *Config, lookup func(string) (string, bool)) error {
+	var errs []error
+	for _, f := range fields(cfg) {
+		if f.env == "" {
+			continue
+		}
+		raw, ok := lookup(f.env)
+		if !ok {
+			continue
+		}
+		if err := setValue(f.value, raw); err != nil {
+			errs = append(errs, fmt.Errorf("env %s: %w", f.env, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func applyFlags(cfg *Config, overrides []override) error {
+	byPath := make(map[string]field)
+	for _, f := range fields(cfg) {
+		byPath[f.path] = f
+	}
+
+	var errs []error
+	for _, o := range overrides {
+		if err := setValue(byPath[o.path].value, o.value); err != nil {
+			errs = append(errs, fmt.Errorf("flag --%s: %w", o.path, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// overrideValue records a config flag for applyFlags, which runs after the file and environment are loaded.
+type overrideValue struct {
+	path      string
+	def       string
+	isBool    bool
+	overrides *[]override
+}
+
+func (o *overrideValue) String() string {
+	return o.def
+}
+
+func (o *overrideValue) Set(s string) error {
+	if o.overrides != nil {
+		*o.overrides = append(*o.overrides, override{path: o.path, value: s})
+	}
+	return nil
+}
+
+func (o *overrideValue) IsBoolFlag() bool {
+	return o.isBool
+}
+
+// newFlagSet registers --config, --print-config and one flag per config value, named by its yaml path.
+func newFlagSet(cfg *Config, overrides *[]override) (*flag.FlagSet, *Options) {
+	opts := &Options{}
+	fs := flag.NewFlagSet("backend-challenge", flag.ContinueOnError)
+	fs.StringVar(&opts.ConfigFile, "config", "", "path of a YAML or TOML config file (env "+ConfigFileEnv+")")
+	fs.BoolVar(&opts.PrintConfig, "print-config", false, "print the resolved configuration with secrets redacted and exit")
+
+	for _, f := range fields(cfg) {
+		def := fmt.Sprint(f.value.Interface())
+		if list, ok := f.value.Interface().([]string); ok {
+			def = strings.Join(list, ",")
+		}
+		if f.secret {
+			def = ""
+		}
+		kind := f.value.Kind().String()
+		if f.value.Kind() == reflect.Slice {
+			kind = "list"
+		}
+		usage := "sets " + f.path + " to the given `" + kind + "`"
+		if f.env != "" {
+			usage += " (env " + f.env + ")"
+		}
+		fs.Var(&overrideValue{
+			path:      f.path,
+			def:       def,
+			isBool:    f.value.Kind() == reflect.Bool,
+			overrides: overrides,
+		}, f.path, usage)
+	}
+	return fs, opts
+}
+
+func parseFlags(args []string, cfg *Config) (Options, []override, error) {
+	var overrides []override
+	fs, opts := newFlagSet(cfg, &overrides)
+	fs.SetOutput(os.Stderr)
+	if err := fs.Parse(args); err != nil {
+		return *opts, nil, err
+	}
+	if fs.NArg() > 0 {
+		return *opts, nil, fmt.Errorf("unexpected arguments: %s", strings.Join(fs.Args(), " "))
+	}
+	return *opts, overrides, nil
+}
+
+// Redacted returns a copy of the configuration that is safe to print or log.
+func (c Config) Redacted() Config {
+	for _, f := range fields(&c) {
+		if !f.secret {
+			continue
+		}
+		switch f.value.Kind() {
+		case reflect.String:
+			if f.value.String() != "" {
+				f.value.SetString(redacted)
+			}
+		case reflect.Slice:
+			// a new slice, the copy shares the elements with c
+			list := make([]string, f.value.Len())
+			for i := range list {
+				list[i] = redacted
+			}
+			f.value.Set(reflect.ValueOf(list))
+		}
+	}
+	return c
+}
+
+func marshalYAML(cfg Config) ([]byte, error) {
+	return yaml.Marshal(cfg)
+}
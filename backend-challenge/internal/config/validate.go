@@ -0,0 +1,137 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// The selectable implementations. They mirror the names in the reader, repository and tracing
+// factories, which import this package and so can not be referenced from here.
+const (
+	HDDReaderType         = "hdd"
+	PrecomputedReaderType = "precomputed"
+	BTreeReaderType       = "btree"
+)
+
+var (
+	readerTypes      = []string{HDDReaderType, PrecomputedReaderType, BTreeReaderType}
+	pendingModes     = []string{"reject", "wait"}
+	indexStrides     = []string{"lines", "bytes", "auto"}
+	cartStoreTypes   = []string{"memory", "file"}
+	logLevels        = []string{"debug", "info", "warn", "error", "fatal"}
+	logFormats       = []string{ConsoleLogFormat, JSONLogFormat}
+	logOutputs       = []string{StdoutLogOutput, FileLogOutput, SyslogLogOutput}
+	syslogNetworks   = []string{"", "udp", "tcp"}
+	tracingExporters = []string{"none", "stdout", "file", "otlp"}
+)
+
+type validator struct {
+	errs []error
+}
+
+func (v *validator) check(ok bool, format string, args ...any) {
+	if !ok {
+		v.errs = append(v.errs, fmt.Errorf(format, args...))
+	}
+}
+
+func (v *validator) positive(path string, value int) {
+	v.check(value > 0, "%s must be greater than 0, got %d", path, value)
+}
+
+func (v *validator) oneOf(path, value string, allowed []string) {
+	v.check(slices.Contains(allowed, value), "%s must be one of [%s], got %q", path, strings.Join(allowed, ", "), value)
+}
+
+// Validate checks every value and returns all the problems found, not just the first one.
+func (c *Config) Validate() error {
+	v := &validator{}
+
+	v.check(c.Server.Port > 0 && c.Server.Port <= 65535, "server.port must be between 1 and 65535, got %d", c.Server.Port)
+	for _, proxy := range c.Server.TrustedProxies {
+		_, _, err := net.ParseCIDR(proxy)
+		v.check(err == nil || net.ParseIP(proxy) != nil, "server.trusted_proxies takes IPs and CIDRs, got %q", proxy)
+	}
+
+	v.oneOf("logging.level", c.Logging.Level, logLevels)
+	v.oneOf("logging.format", c.Logging.Format, logFormats)
+	v.oneOf("logging.output", c.Logging.Output, logOutputs)
+	v.positive("logging.debug_sample_rate", c.Logging.DebugSampleRate)
+	if c.Logging.Output == FileLogOutput {
+		v.check(c.Logging.File.Path != "", "logging.file.path is required when logging.output is file")
+		v.positive("logging.file.max_size_mb", c.Logging.File.MaxSizeMB)
+		v.check(c.Logging.File.MaxAgeDays >= 0, "logging.file.max_age_days must not be negative")
+		v.check(c.Logging.File.MaxBackups >= 0, "logging.file.max_backups must not be negative")
+	}
+	if c.Logging.Output == SyslogLogOutput {
+		v.oneOf("logging.syslog.network", c.Logging.Syslog.Network, syslogNetworks)
+		v.check(c.Logging.Syslog.Network == "" || c.Logging.Syslog.Address != "",
+			"logging.syslog.address is required when logging.syslog.network is set")
+	}
+
+	v.oneOf("coupon.reader_type", c.Coupon.ReaderType, readerTypes)
+	v.check(c.Coupon.FolderPath != "", "coupon.folder_path is required (env COUPON_CODE_FOLDER_PATH)")
+	v.positive("coupon.partial_index_chunk_size", c.Coupon.PartialIndexChunkSize)
+	v.oneOf("coupon.partial_index_stride", c.Coupon.PartialIndexStride, indexStrides)
+	v.positive("coupon.partial_index_stride_bytes", c.Coupon.PartialIndexStrideBytes)
+	v.positive("coupon.partial_index_memory_bytes", c.Coupon.PartialIndexMemoryBytes)
+	v.positive("coupon.partial_index_read_bytes", c.Coupon.PartialIndexReadBytes)
+	v.positive("coupon.search_pool_size", c.Coupon.SearchPoolSize)
+	v.positive("coupon.index_build_concurrency", c.Coupon.IndexBuildConcurrency)
+	v.oneOf("coupon.index_pending_mode", c.Coupon.IndexPendingMode, pendingModes)
+	v.positive("coupon.index_pending_wait_seconds", c.Coupon.IndexPendingWaitSeconds)
+	v.positive("coupon.index_retry_after_seconds", c.Coupon.IndexRetryAfterSeconds)
+
+	policy := c.Coupon.Policy
+	v.check(policy.MinFileMatches >= 0, "coupon.policy.min_file_matches must not be negative, got %d", policy.MinFileMatches)
+	v.check(policy.MinFileMatches > 0 || len(policy.RequiredFiles) > 0,
+		"coupon.policy needs min_file_matches greater than 0 or required_files, otherwise every code is valid")
+	v.positive("coupon.policy.min_length", policy.MinLength)
+	v.check(policy.MaxLength >= policy.MinLength, "coupon.policy.max_length must not be less than min_length, got %d", policy.MaxLength)
+	if policy.Charset != "" {
+		_, err := regexp.Compile("^[" + policy.Charset + "]+$")
+		v.check(err == nil, "coupon.policy.charset must be a regular expression character class: %v", err)
+	}
+	for _, file := range policy.RequiredFiles {
+		v.check(!strings.ContainsAny(file, `/\`), "coupon.policy.required_files takes file names, got %q", file)
+	}
+
+	if c.Coupon.Cache.Enabled {
+		v.positive("coupon.cache.size", c.Coupon.Cache.Size)
+		v.positive("coupon.cache.positive_ttl_seconds", c.Coupon.Cache.PositiveTTLSeconds)
+		v.check(c.Coupon.Cache.NegativeTTLSeconds >= 0, "coupon.cache.negative_ttl_seconds must not be negative, got %d", c.Coupon.Cache.NegativeTTLSeconds)
+	}
+
+	v.oneOf("repositories.cart.type", c.Repositories.Cart.Type, cartStoreTypes)
+	if c.Repositories.Cart.Type == "file" {
+		v.check(c.Repositories.Cart.StorePath != "", "repositories.cart.store_path is required when repositories.cart.type is file")
+	}
+	v.positive("repositories.cart.inactivity_ttl_minutes", c.Repositories.Cart.InactivityTTLMinutes)
+
+	for i, key := range c.RateLimit.APIKeys {
+		v.check(key != "" && strings.TrimSpace(key) == key, "rate_limit.api_keys must not hold empty keys or keys with surrounding spaces, got key %d", i+1)
+		v.check(!slices.Contains(c.RateLimit.APIKeys[:i], key), "rate_limit.api_keys must not repeat a key, key %d is a repeat", i+1)
+	}
+	if c.RateLimit.Enabled {
+		v.positive("rate_limit.order.per_minute", c.RateLimit.Order.PerMinute)
+		v.positive("rate_limit.order.burst", c.RateLimit.Order.Burst)
+		v.positive("rate_limit.coupon.per_minute", c.RateLimit.Coupon.PerMinute)
+		v.positive("rate_limit.coupon.burst", c.RateLimit.Coupon.Burst)
+		v.positive("rate_limit.coupon.lockout_threshold", c.RateLimit.Coupon.LockoutThreshold)
+		v.positive("rate_limit.coupon.lockout_base_seconds", c.RateLimit.Coupon.LockoutBaseSeconds)
+		v.check(c.RateLimit.Coupon.LockoutMaxSeconds >= c.RateLimit.Coupon.LockoutBaseSeconds,
+			"rate_limit.coupon.lockout_max_seconds must not be less than lockout_base_seconds, got %d", c.RateLimit.Coupon.LockoutMaxSeconds)
+	}
+
+	v.oneOf("tracing.exporter", c.Tracing.Exporter, tracingExporters)
+	if c.Tracing.Exporter == "file" {
+		v.check(c.Tracing.FilePath != "", "tracing.file_path is required when tracing.exporter is file")
+	}
+	v.check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1, "tracing.sample_ratio must be between 0 and 1, got %g", c.Tracing.SampleRatio)
+
+	return errors.Join(v.errs...)
+}
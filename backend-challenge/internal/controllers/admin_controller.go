@@ -0,0 +1,161 @@
+package controllers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/dekanayake/kart-challenge/backend-challenge/internal/config"
+	"github.com/dekanayake/kart-challenge/backend-challenge/internal/reader"
+	"github.com/gin-gonic/gin"
+)
+
+type AdminController struct {
+	FileReader reader.FileReader
+}
+
+func NewAdminController(fileReader reader.FileReader) *AdminController {
+	return &AdminController{
+		FileReader: fileReader,
+	}
+}
+
+func (a *AdminController) GetLogLevel(c *gin.Context) {
+	c.JSON(http.StatusOK, LogLevel{Level: config.CurrentLogLevel()})
+}
+
+// SetLogLevel changes the log level of the running service, it is not persisted across restarts.
+func (a *AdminController) SetLogLevel(c *gin.Context) {
+	var req LogLevel
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+
+	previous := config.CurrentLogLevel()
+	if err := config.SetLogLevel(req.Level); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	config.LoggerFrom(c.Request.Context()).Warn().
+		Str("previous", previous).
+		Str("level", config.CurrentLogLevel()).
+		Msg("Log level changed")
+
+	c.JSON(http.StatusOK, LogLevel{Level: config.CurrentLogLevel()})
+}
+
+// indexAdmin writes a 501 when the configured coupon reader has no indexes to administer.
+func (a *AdminController) indexAdmin(c *gin.Context) (reader.IndexAdmin, bool) {
+	admin, ok := a.FileReader.(reader.IndexAdmin)
+	if !ok {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "the coupon reader does not support index administration"})
+		return nil, false
+	}
+	return admin, true
+}
+
+func (a *AdminController) ListCouponIndexes(c *gin.Context) {
+	admin, ok := a.indexAdmin(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, CouponIndexes{
+		State:   a.FileReader.Status().State,
+		Indexes: admin.Indexes(),
+	})
+}
+
+// RebuildCouponIndexes rebuilds one or all coupon indexes and responds once the new indexes are serving.
+func (a *AdminController) RebuildCouponIndexes(c *gin.Context) {
+	admin, ok := a.indexAdmin(c)
+	if !ok {
+		return
+	}
+
+	var req CouponIndexRebuildReq
+	// the body is optional, no body rebuilds every file
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+
+	start := time.Now()
+	rebuilt, err := admin.Rebuild(c.Request.Context(), req.File)
+	switch {
+	case errors.Is(err, reader.ErrUnknownIndex):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, reader.ErrIndexBuilding), errors.Is(err, reader.ErrRebuildInProgress):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		config.LoggerFrom(c.Request.Context()).Error().Err(err).Str("file", req.File).Msg("Coupon index rebuild failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	config.LoggerFrom(c.Request.Context()).Warn().
+		Str("file", req.File).
+		Int("files", len(rebuilt)).
+		Msg("Coupon indexes rebuilt")
+
+	c.JSON(http.StatusOK, CouponIndexRebuild{
+		Rebuilt:    rebuilt,
+		DurationMs: time.Since(start).Milliseconds(),
+	})
+}
+
+// ExplainCoupon shows which files a coupon code was found in, skipped or searched without a hit.
+// It searches the files even when the lookup cache holds the code, and does not count towards the
+// coupon rate limits or lockouts.
+func (a *AdminController) ExplainCoupon(c *gin.Context) {
+	fileReader := a.FileReader
+	if cache, ok := fileReader.(reader.CacheAdmin); ok {
+		fileReader = cache.Uncached()
+	}
+	explanation, err := fileReader.ExplainPromo(c.Request.Context(), c.Param("code"))
+	if errors.Is(err, reader.ErrIndexBuilding) || errors.Is(err, reader.ErrReaderUnavailable) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+	// per file errors are part of the explanation
+	if err != nil {
+		config.LoggerFrom(c.Request.Context()).Warn().Err(err).Msg("Coupon explanation has file errors")
+	}
+
+	c.JSON(http.StatusOK, explanation)
+}
+
+// cacheAdmin writes a 501 when the coupon lookup cache is not enabled.
+func (a *AdminController) cacheAdmin(c *gin.Context) (reader.CacheAdmin, bool) {
+	admin, ok := a.FileReader.(reader.CacheAdmin)
+	if !ok {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "the coupon lookup cache is not enabled"})
+		return nil, false
+	}
+	return admin, true
+}
+
+func (a *AdminController) GetCouponCache(c *gin.Context) {
+	admin, ok := a.cacheAdmin(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, admin.CacheStats())
+}
+
+// PurgeCouponCache drops every cached coupon lookup result, e.g. after a coupon file was replaced
+// without an index rebuild.
+func (a *AdminController) PurgeCouponCache(c *gin.Context) {
+	admin, ok := a.cacheAdmin(c)
+	if !ok {
+		return
+	}
+	admin.Purge()
+	config.LoggerFrom(c.Request.Context()).Warn().Msg("Coupon lookup cache purged")
+	c.JSON(http.StatusOK, admin.CacheStats())
+}
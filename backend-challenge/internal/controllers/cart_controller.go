@@ -0,0 +1,359 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/dekanayake/kart-challenge/backend-challenge/internal/config"
+	"github.com/dekanayake/kart-challenge/backend-challenge/internal/coupon"
+	"github.com/dekanayake/kart-challenge/backend-challenge/internal/pricing"
+	"github.com/dekanayake/kart-challenge/backend-challenge/internal/repository"
+)
+
+type CartController struct {
+	CartRepo        repository.CartRepository
+	ProductRepo     repository.ProductRepository
+	OrderController *OrderController
+}
+
+func NewCartController(cartRepo repository.CartRepository, productRepo repository.ProductRepository, orderController *OrderController) *CartController {
+	return &CartController{
+		CartRepo:        cartRepo,
+		ProductRepo:     productRepo,
+		OrderController: orderController,
+	}
+}
+
+func (c *CartController) CreateCart(ctx *gin.Context) {
+	cart, err := c.CartRepo.CreateCart(ctx.Request.Context())
+	if err != nil {
+		config.LoggerFrom(ctx.Request.Context()).Error().Err(err).Msg("Repository error while creating cart")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create cart"})
+		return
+	}
+
+	c.respondWithCart(ctx, http.StatusCreated, cart)
+}
+
+func (c *CartController) GetCart(ctx *gin.Context) {
+	cart, ok := c.loadCart(ctx)
+	if !ok {
+		return
+	}
+
+	c.respondWithCart(ctx, http.StatusOK, cart)
+}
+
+// AddItem adds the quantity to the product already in the cart, or adds the product as a new item.
+func (c *CartController) AddItem(ctx *gin.Context) {
+	var req CartItemReq
+	if err := ctx.ShouldBindJSON(&req); err != nil || req.Quantity <= 0 {
+		config.LoggerFrom(ctx.Request.Context()).Warn().Err(err).Msg("invalid cart item payload")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+
+	if _, ok := c.loadCart(ctx); !ok {
+		return
+	}
+	if !c.productExists(ctx, req.ProductID) {
+		return
+	}
+
+	c.updateCart(ctx, func(cart *repository.Cart) {
+		for i := range cart.Items {
+			if cart.Items[i].ProductId == req.ProductID {
+				cart.Items[i].Quantity += req.Quantity
+				return
+			}
+		}
+		cart.Items = append(cart.Items, repository.CartItem{
+			ProductId: req.ProductID,
+			Quantity:  req.Quantity,
+		})
+	})
+}
+
+// SetItemQuantity replaces the quantity of a product in the cart. A quantity of zero removes the item.
+func (c *CartController) SetItemQuantity(ctx *gin.Context) {
+	productID := ctx.Param("productId")
+
+	var req CartQuantityReq
+	if err := ctx.ShouldBindJSON(&req); err != nil || *req.Quantity < 0 {
+		config.LoggerFrom(ctx.Request.Context()).Warn().Err(err).Msg("invalid cart quantity payload")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+
+	if *req.Quantity == 0 {
+		c.updateCart(ctx, func(cart *repository.Cart) {
+			cart.Items = removeCartItem(cart.Items, productID)
+		})
+		return
+	}
+	if _, ok := c.loadCart(ctx); !ok {
+		return
+	}
+	if !c.productExists(ctx, productID) {
+		return
+	}
+
+	c.updateCart(ctx, func(cart *repository.Cart) {
+		for i := range cart.Items {
+			if cart.Items[i].ProductId == productID {
+				cart.Items[i].Quantity = *req.Quantity
+				return
+			}
+		}
+		cart.Items = append(cart.Items, repository.CartItem{
+			ProductId: productID,
+			Quantity:  *req.Quantity,
+		})
+	})
+}
+
+func (c *CartController) RemoveItem(ctx *gin.Context) {
+	productID := ctx.Param("productId")
+	c.updateCart(ctx, func(cart *repository.Cart) {
+		cart.Items = removeCartItem(cart.Items, productID)
+	})
+}
+
+// ApplyCoupon validates the coupon the same way order creation does before storing it on the cart.
+func (c *CartController) ApplyCoupon(ctx *gin.Context) {
+	var req CartCouponReq
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		config.LoggerFrom(ctx.Request.Context()).Warn().Err(err).Msg("invalid cart coupon payload")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+
+	if _, ok := c.loadCart(ctx); !ok {
+		return
+	}
+
+	record, couponErr := c.OrderController.validateCoupon(ctx.Request.Context(), req.CouponCode)
+	if couponErr != nil {
+		writeOrderError(ctx, couponErr)
+		return
+	}
+
+	c.updateCart(ctx, func(cart *repository.Cart) {
+		cart.CouponCode = record.Code
+		cart.CouponRecord = *record
+	})
+}
+
+func (c *CartController) RemoveCoupon(ctx *gin.Context) {
+	c.updateCart(ctx, func(cart *repository.Cart) {
+		cart.CouponCode = ""
+		cart.CouponRecord = coupon.Record{}
+	})
+}
+
+// Checkout converts the cart to an order through the regular order creation path and then removes the cart.
+// The cart is marked checked out first, so concurrent checkouts of a cart create one order and the
+// order is created from the cart as it was read.
+func (c *CartController) Checkout(ctx *gin.Context) {
+	cart, ok := c.loadCart(ctx)
+	if !ok {
+		return
+	}
+
+	cart, err := c.CartRepo.MarkCheckedOut(ctx.Request.Context(), cart)
+	if err != nil {
+		c.writeCartError(ctx, ctx.Param("cartId"), err)
+		return
+	}
+
+	req := OrderReq{
+		CouponCode: cart.CouponCode,
+		Items:      make([]OrderItem, 0, len(cart.Items)),
+	}
+	for _, item := range cart.Items {
+		req.Items = append(req.Items, OrderItem{
+			ProductID: item.ProductId,
+			Quantity:  item.Quantity,
+		})
+	}
+
+	order, orderErr := c.OrderController.placeOrder(ctx.Request.Context(), req)
+	if orderErr != nil {
+		err := c.CartRepo.ReopenCart(ctx.Request.Context(), cart.ID)
+		if err != nil {
+			config.LoggerFrom(ctx.Request.Context()).Warn().Err(err).Str("cartId", cart.ID).Msg("Failed to reopen cart after a failed checkout")
+		}
+		writeOrderError(ctx, orderErr)
+		return
+	}
+
+	err = c.CartRepo.DeleteCart(ctx.Request.Context(), cart.ID)
+	if err != nil {
+		config.LoggerFrom(ctx.Request.Context()).Warn().Err(err).Str("cartId", cart.ID).Msg("Failed to remove cart after checkout")
+	}
+
+	config.LoggerFrom(ctx.Request.Context()).Info().
+		Str("cartId", cart.ID).
+		Str("orderId", order.ID).
+		Msg("Cart checked out")
+
+	ctx.JSON(http.StatusCreated, order)
+}
+
+// loadCart fetches the cart from the path parameter and writes the error response when it is not available.
+func (c *CartController) loadCart(ctx *gin.Context) (*repository.Cart, bool) {
+	id := ctx.Param("cartId")
+
+	cart, err := c.CartRepo.GetCart(ctx.Request.Context(), id)
+	if err != nil {
+		config.LoggerFrom(ctx.Request.Context()).Error().Err(err).Str("cartId", id).Msg("Repository error while fetching cart")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch cart"})
+		return nil, false
+	}
+	if cart == nil {
+		config.LoggerFrom(ctx.Request.Context()).Warn().Str("cartId", id).Msg("Cart not found or expired")
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "cart not found"})
+		return nil, false
+	}
+	return cart, true
+}
+
+func (c *CartController) productExists(ctx *gin.Context, productID string) bool {
+	product, err := c.ProductRepo.GetProductByID(ctx.Request.Context(), productID)
+	if err != nil {
+		config.LoggerFrom(ctx.Request.Context()).Error().Err(err).Str("productId", productID).Msg("Repository error while fetching product")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to fetch product"})
+		return false
+	}
+	if product == nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "product not found"})
+		return false
+	}
+	return true
+}
+
+// maxCartUpdateAttempts bounds how often a cart change is applied again after losing the race to
+// a concurrent change of the cart.
+const maxCartUpdateAttempts = 3
+
+// updateCart applies the change to the cart from the path parameter and saves it, starting over from
+// the saved cart when another request saved it in between.
+func (c *CartController) updateCart(ctx *gin.Context, change func(cart *repository.Cart)) {
+	for attempt := 1; ; attempt++ {
+		cart, ok := c.loadCart(ctx)
+		if !ok {
+			return
+		}
+		change(cart)
+
+		saved, err := c.CartRepo.SaveCart(ctx.Request.Context(), cart)
+		if errors.Is(err, repository.ErrCartConflict) && attempt < maxCartUpdateAttempts {
+			continue
+		}
+		if err != nil {
+			c.writeCartError(ctx, cart.ID, err)
+			return
+		}
+
+		c.respondWithCart(ctx, http.StatusOK, saved)
+		return
+	}
+}
+
+// writeCartError writes the response for an error of a cart change.
+func (c *CartController) writeCartError(ctx *gin.Context, id string, err error) {
+	switch {
+	case errors.Is(err, repository.ErrCartNotFound):
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "cart not found"})
+	case errors.Is(err, repository.ErrCartCheckedOut):
+		ctx.JSON(http.StatusConflict, gin.H{"error": "cart is being checked out"})
+	case errors.Is(err, repository.ErrCartConflict):
+		ctx.JSON(http.StatusConflict, gin.H{"error": "cart was changed by another request, try again"})
+	default:
+		config.LoggerFrom(ctx.Request.Context()).Error().Err(err).Str("cartId", id).Msg("Repository error while saving cart")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save cart"})
+	}
+}
+
+func (c *CartController) respondWithCart(ctx *gin.Context, status int, cart *repository.Cart) {
+	items := make([]OrderItem, 0, len(cart.Items))
+	for _, item := range cart.Items {
+		items = append(items, OrderItem{
+			ProductID: item.ProductId,
+			Quantity:  item.Quantity,
+		})
+	}
+
+	quote, couponErr, priceErr := c.quoteCart(ctx.Request.Context(), items, cart)
+	if priceErr != nil {
+		writeOrderError(ctx, priceErr)
+		return
+	}
+
+	response := Cart{
+		ID:         cart.ID,
+		CouponCode: cart.CouponCode,
+		Items:      pricedItems(quote.Lines),
+		Subtotal:   quote.Subtotal,
+		Discount:   quote.Discount,
+		Total:      quote.Total,
+		ExpiresAt:  cart.ExpiresAt,
+	}
+	if couponErr != nil {
+		response.CouponError = couponErr.message
+	}
+	ctx.JSON(status, response)
+}
+
+// quoteCart prices the cart like an order is quoted, with the coupon record kept on the cart instead
+// of a new lookup, so the cart shows the discount its checkout gets. A coupon that does not apply now
+// is returned as the coupon error and the cart is priced without it.
+func (c *CartController) quoteCart(ctx context.Context, items []OrderItem, cart *repository.Cart) (*pricing.Quote, *orderError, *orderError) {
+	if cart.CouponCode == "" {
+		quote, orderErr := c.OrderController.priceOrder(ctx, items, nil)
+		return quote, nil, orderErr
+	}
+
+	record := cart.CouponRecord
+	couponErr := c.OrderController.checkCoupon(ctx, &record)
+	if couponErr == nil {
+		quote, orderErr := c.OrderController.priceOrder(ctx, items, &record)
+		if orderErr == nil || !orderErr.coupon {
+			return quote, nil, orderErr
+		}
+		couponErr = orderErr
+	}
+	if !couponErr.coupon {
+		return nil, nil, couponErr
+	}
+	quote, orderErr := c.OrderController.priceOrder(ctx, items, nil)
+	return quote, couponErr, orderErr
+}
+
+func pricedItems(lines []pricing.PricedLine) []PricedItem {
+	items := make([]PricedItem, 0, len(lines))
+	for _, line := range lines {
+		items = append(items, PricedItem{
+			ProductID: line.ProductID,
+			Name:      line.Name,
+			Category:  line.Category,
+			UnitPrice: line.UnitPrice,
+			Quantity:  line.Quantity,
+			LineTotal: line.LineTotal,
+		})
+	}
+	return items
+}
+
+func removeCartItem(items []repository.CartItem, productID string) []repository.CartItem {
+	remaining := make([]repository.CartItem, 0, len(items))
+	for _, item := range items {
+		if item.ProductId != productID {
+			remaining = append(remaining, item)
+		}
+	}
+	return remaining
+}
@@ -1,5 +1,13 @@
 package controllers
 
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/dekanayake/kart-challenge/backend-challenge/internal/reader"
+)
+
 type Product struct {
 	ID       string  `json:"id" example:"10"`
 	Name     string  `json:"name" example:"Chicken Waffle"`
@@ -22,3 +30,76 @@ type Order struct {
 	Items    []OrderItem `json:"items"`
 	Products []Product   `json:"products"`
 }
+
+type CartItemReq struct {
+	ProductID string `json:"productId" binding:"required"`
+	Quantity  int    `json:"quantity" binding:"required"`
+}
+
+type CartQuantityReq struct {
+	Quantity *int `json:"quantity" binding:"required"`
+}
+
+type CartCouponReq struct {
+	CouponCode string `json:"couponCode" binding:"required"`
+}
+
+type PricedItem struct {
+	ProductID string  `json:"productId"`
+	Name      string  `json:"name"`
+	Category  string  `json:"category"`
+	UnitPrice float64 `json:"unitPrice"`
+	Quantity  int     `json:"quantity"`
+	LineTotal float64 `json:"lineTotal"`
+}
+
+type Cart struct {
+	ID         string `json:"id"`
+	CouponCode string `json:"couponCode,omitempty"`
+	// CouponError is why the coupon of the cart does not apply to it now, the cart is priced without it.
+	CouponError string       `json:"couponError,omitempty"`
+	Items       []PricedItem `json:"items"`
+	Subtotal    float64      `json:"subtotal"`
+	Discount    float64      `json:"discount"`
+	Total       float64      `json:"total"`
+	ExpiresAt   time.Time    `json:"expiresAt"`
+}
+
+type OrderQuote struct {
+	CouponCode string       `json:"couponCode,omitempty"`
+	Items      []PricedItem `json:"items"`
+	Subtotal   float64      `json:"subtotal"`
+	Discount   float64      `json:"discount"`
+	Total      float64      `json:"total"`
+}
+
+type LogLevel struct {
+	Level string `json:"level" binding:"required" example:"debug"`
+}
+
+type DependencyCheck struct {
+	Status  string `json:"status" example:"ok"`
+	Error   string `json:"error,omitempty"`
+	Details gin.H  `json:"details,omitempty"`
+}
+
+type ReadinessResponse struct {
+	Status    string                     `json:"status" example:"ready"`
+	Timestamp string                     `json:"timestamp"`
+	Checks    map[string]DependencyCheck `json:"checks"`
+}
+
+type CouponIndexes struct {
+	State   reader.State       `json:"state" example:"ready"`
+	Indexes []reader.IndexInfo `json:"indexes"`
+}
+
+// CouponIndexRebuildReq names the coupon file to rebuild, by path or file name. All files are rebuilt when it is empty.
+type CouponIndexRebuildReq struct {
+	File string `json:"file" example:"couponbase1"`
+}
+
+type CouponIndexRebuild struct {
+	Rebuilt    []reader.IndexInfo `json:"rebuilt"`
+	DurationMs int64              `json:"durationMs"`
+}
@@ -1,20 +1,125 @@
 package controllers
 
 import (
+	"context"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
+
+	"github.com/dekanayake/kart-challenge/backend-challenge/internal/config"
+	"github.com/dekanayake/kart-challenge/backend-challenge/internal/reader"
+	"github.com/dekanayake/kart-challenge/backend-challenge/internal/repository"
+)
+
+const (
+	CheckOK       = "ok"
+	CheckFailed   = "failed"
+	CheckBuilding = "building"
 )
 
+// readinessTimeout bounds how long the dependency checks of one readiness probe may take.
+const readinessTimeout = 2 * time.Second
+
 type HealthResponse struct {
 	Status    string `json:"status"`
 	Timestamp string `json:"timestamp"`
 }
 
-func HealthHandler(c *gin.Context) {
+type HealthController struct {
+	ProductRepo repository.ProductRepository
+	OrderRepo   repository.OrderRepository
+	CartRepo    repository.CartRepository
+	FileReader  reader.FileReader
+}
+
+func NewHealthController(productRepo repository.ProductRepository, orderRepo repository.OrderRepository, cartRepo repository.CartRepository, fileReader reader.FileReader) *HealthController {
+	return &HealthController{
+		ProductRepo: productRepo,
+		OrderRepo:   orderRepo,
+		CartRepo:    cartRepo,
+		FileReader:  fileReader,
+	}
+}
+
+// Live reports the process is up and serving HTTP, it does not check any dependency.
+func (h *HealthController) Live(c *gin.Context) {
 	c.JSON(http.StatusOK, HealthResponse{
 		Status:    "ok",
 		Timestamp: time.Now().Format(time.RFC3339),
 	})
 }
+
+// Ready reports each dependency and returns 503 unless all of them can serve requests.
+func (h *HealthController) Ready(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), readinessTimeout)
+	defer cancel()
+
+	checks := map[string]DependencyCheck{
+		"productRepository": pingCheck(ctx, h.ProductRepo),
+		"orderRepository":   pingCheck(ctx, h.OrderRepo),
+		"cartRepository":    pingCheck(ctx, h.CartRepo),
+		"catalog":           h.catalogCheck(ctx),
+		"couponIndex":       h.couponIndexCheck(),
+	}
+
+	status, code := "ready", http.StatusOK
+	for name, check := range checks {
+		if check.Status != CheckOK {
+			status, code = "not_ready", http.StatusServiceUnavailable
+			config.LoggerFrom(ctx).Warn().
+				Str("dependency", name).
+				Str("status", check.Status).
+				Str("error", check.Error).
+				Msg("Readiness check not passing")
+		}
+	}
+
+	c.JSON(code, ReadinessResponse{
+		Status:    status,
+		Timestamp: time.Now().Format(time.RFC3339),
+		Checks:    checks,
+	})
+}
+
+type pinger interface {
+	Ping(ctx context.Context) error
+}
+
+func pingCheck(ctx context.Context, repo pinger) DependencyCheck {
+	if err := repo.Ping(ctx); err != nil {
+		return DependencyCheck{Status: CheckFailed, Error: err.Error()}
+	}
+	return DependencyCheck{Status: CheckOK}
+}
+
+func (h *HealthController) catalogCheck(ctx context.Context) DependencyCheck {
+	page, err := h.ProductRepo.ListProducts(ctx, 1, 1)
+	if err != nil {
+		return DependencyCheck{Status: CheckFailed, Error: err.Error()}
+	}
+	if page.Total == 0 {
+		return DependencyCheck{Status: CheckFailed, Error: "product catalog is empty"}
+	}
+	return DependencyCheck{Status: CheckOK, Details: gin.H{"products": page.Total}}
+}
+
+func (h *HealthController) couponIndexCheck() DependencyCheck {
+	status := h.FileReader.Status()
+
+	check := DependencyCheck{Error: status.Error, Details: gin.H{"files": status.Files}}
+	switch status.State {
+	case reader.StateReady:
+		check.Status = CheckOK
+		// the indexes from before a failed rebuild serve, but may not match the coupon files any more
+		if status.RebuildError != "" {
+			check.Status = CheckFailed
+			check.Error = "last index rebuild failed: " + status.RebuildError
+		}
+	case reader.StateBuilding:
+		check.Status = CheckBuilding
+	default:
+		check.Status = CheckFailed
+	}
+	return check
+}
@@ -2,11 +2,19 @@ package controllers
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
 	"github.com/dekanayake/kart-challenge/backend-challenge/internal/config"
+	"github.com/dekanayake/kart-challenge/backend-challenge/internal/coupon"
+	"github.com/dekanayake/kart-challenge/backend-challenge/internal/metrics"
+	"github.com/dekanayake/kart-challenge/backend-challenge/internal/pricing"
+	"github.com/dekanayake/kart-challenge/backend-challenge/internal/ratelimit"
 	"github.com/dekanayake/kart-challenge/backend-challenge/internal/reader"
 	"github.com/dekanayake/kart-challenge/backend-challenge/internal/repository"
 )
@@ -15,13 +23,26 @@ type OrderController struct {
 	OrderRepo   repository.OrderRepository
 	ProductRepo repository.ProductRepository
 	FileReader  reader.FileReader
+	CouponGuard *ratelimit.CouponGuard // nil when coupon lookups are not rate limited
 }
 
-func NewOrderController(orderRepo repository.OrderRepository, productRepo repository.ProductRepository, reader reader.FileReader) *OrderController {
+// orderError is a rejected order request, with the HTTP status and message returned to the client.
+type orderError struct {
+	status    int
+	message   string
+	rateLimit *ratelimit.Decision
+	// retryAfter is sent as the Retry-After header when set
+	retryAfter time.Duration
+	// coupon is set when the coupon does not apply to the order, which can be priced without it
+	coupon bool
+}
+
+func NewOrderController(orderRepo repository.OrderRepository, productRepo repository.ProductRepository, reader reader.FileReader, couponGuard *ratelimit.CouponGuard) *OrderController {
 	return &OrderController{
 		OrderRepo:   orderRepo,
 		ProductRepo: productRepo,
 		FileReader:  reader,
+		CouponGuard: couponGuard,
 	}
 }
 
@@ -29,94 +50,285 @@ func (c *OrderController) CreateOrder(ctx *gin.Context) {
 	var req OrderReq
 
 	if err := ctx.ShouldBindJSON(&req); err != nil {
-		config.Logger.Warn().Err(err).Msg("invalid order payload")
+		config.LoggerFrom(ctx.Request.Context()).Warn().Err(err).Msg("invalid order payload")
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
 		return
 	}
 
-	if len(req.Items) == 0 {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Order must contain at least one item"})
+	order, orderErr := c.placeOrder(ctx.Request.Context(), req)
+	if orderErr != nil {
+		writeOrderError(ctx, orderErr)
 		return
 	}
 
-	if req.CouponCode != "" {
-		length := len(req.CouponCode)
-		if length < 8 || length > 10 {
-			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Coupon code is invalid"})
-			return
-		}
+	ctx.JSON(http.StatusCreated, order)
+}
 
-		valid, err := c.FileReader.SearchPromo(context.Background(), req.CouponCode)
-		if err != nil {
-			config.Logger.Err(err).Msg("Coupon code validation failed")
-			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Coupon code validation failed"})
-			return
-		}
-		config.Logger.Debug().Bool("valid", valid).Msg("Coupon code validated")
-		if !valid {
-			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Coupon code is invalid"})
-			return
-		}
+// QuoteOrder prices an order request exactly as CreateOrder would, without persisting anything.
+func (c *OrderController) QuoteOrder(ctx *gin.Context) {
+	var req OrderReq
+
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		config.LoggerFrom(ctx.Request.Context()).Warn().Err(err).Msg("invalid order quote payload")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
 	}
 
-	orderItems := make([]repository.OrderItem, 0)
+	quote, _, orderErr := c.quoteOrder(ctx.Request.Context(), req)
+	if orderErr != nil {
+		writeOrderError(ctx, orderErr)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, OrderQuote{
+		CouponCode: quote.CouponCode,
+		Items:      pricedItems(quote.Lines),
+		Subtotal:   quote.Subtotal,
+		Discount:   quote.Discount,
+		Total:      quote.Total,
+	})
+}
+
+// quoteOrder validates the order request, including the coupon, and prices it. The coupon record
+// is nil for orders without a coupon. Both the quote endpoint and order creation use it, so the
+// quoted total is the charged total.
+func (c *OrderController) quoteOrder(ctx context.Context, req OrderReq) (*pricing.Quote, *coupon.Record, *orderError) {
+	if len(req.Items) == 0 {
+		return nil, nil, &orderError{status: http.StatusBadRequest, message: "Order must contain at least one item"}
+	}
 
 	for _, orderItem := range req.Items {
-		product, err := c.ProductRepo.GetProductByID(orderItem.ProductID)
-		if err != nil {
-			config.Logger.Err(err).Str("product id", orderItem.ProductID).Msg("Error occured while retrieving product for id")
-			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Failed to create order"})
+		if orderItem.Quantity <= 0 {
+			return nil, nil, &orderError{status: http.StatusBadRequest, message: "Item quantity must be greater than zero"}
 		}
-		if product == nil {
-			config.Logger.Error().Str("product id", orderItem.ProductID).Msg("Product does not exist for the order item")
-			ctx.JSON(http.StatusBadRequest, gin.H{"error": "product not found in order item"})
+	}
+
+	var record *coupon.Record
+	if req.CouponCode != "" {
+		var couponErr *orderError
+		if record, couponErr = c.validateCoupon(ctx, req.CouponCode); couponErr != nil {
+			return nil, nil, couponErr
 		}
+	}
+	quote, orderErr := c.priceOrder(ctx, req.Items, record)
+	if orderErr != nil {
+		return nil, nil, orderErr
+	}
+	return quote, record, nil
+}
 
+// priceOrder prices the items with the discount of the coupon record, nil for no coupon, and checks
+// the minimum order value of the record. The record must have been checked with checkCoupon.
+func (c *OrderController) priceOrder(ctx context.Context, items []OrderItem, record *coupon.Record) (*pricing.Quote, *orderError) {
+	if record == nil {
+		return priceItems(ctx, c.ProductRepo, items, "", coupon.Rule{})
+	}
+	quote, orderErr := priceItems(ctx, c.ProductRepo, items, record.Code, record.Discount)
+	if orderErr != nil {
+		return nil, orderErr
+	}
+	if quote.Subtotal < record.MinOrderValue {
+		return nil, &orderError{
+			status:  http.StatusBadRequest,
+			message: fmt.Sprintf("Coupon code requires an order of at least %.2f", record.MinOrderValue),
+			coupon:  true,
+		}
+	}
+	return quote, nil
+}
+
+// placeOrder validates and prices the order request and persists it. Every way of creating an order,
+// including cart checkout, goes through here.
+func (c *OrderController) placeOrder(ctx context.Context, req OrderReq) (*Order, *orderError) {
+	quote, record, orderErr := c.quoteOrder(ctx, req)
+	if orderErr != nil {
+		return nil, orderErr
+	}
+	maxUses := 0
+	if record != nil {
+		maxUses = record.MaxUses
+	}
+
+	orderItems := make([]repository.OrderItem, 0)
+	for _, line := range quote.Lines {
 		orderItems = append(orderItems, repository.OrderItem{
-			ProductId: orderItem.ProductID,
-			Quantity:  orderItem.Quantity,
+			ProductId: line.ProductID,
+			Quantity:  line.Quantity,
 		})
 	}
 
-	createdOrder, err := c.OrderRepo.CreateOrder(orderItems, req.CouponCode)
+	createdOrder, err := c.OrderRepo.CreateOrder(ctx, orderItems, quote.CouponCode, maxUses)
+	if errors.Is(err, repository.ErrCouponUsedUp) {
+		return nil, &orderError{status: http.StatusBadRequest, message: couponMessage(err)}
+	}
 	if err != nil {
-		config.Logger.Error().Err(err).Msg("failed to create order")
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Failed to create order"})
-		return
+		config.LoggerFrom(ctx).Error().Err(err).Msg("failed to create order")
+		return nil, &orderError{status: http.StatusBadRequest, message: "Failed to create order"}
 	}
 
-	config.Logger.Info().
+	metrics.OrdersCreated.Inc()
+	config.LoggerFrom(ctx).Info().
 		Str("orderId", createdOrder.ID).
 		Str("couponCode", createdOrder.CouponCode).
 		Int("items", len(req.Items)).
+		Float64("total", quote.Total).
 		Msg("Order created successfully")
 
 	itemsResponse := make([]OrderItem, 0)
 	productsResponse := make([]Product, 0)
 
-	for _, item := range createdOrder.Items {
+	for _, line := range quote.Lines {
 		itemsResponse = append(itemsResponse, OrderItem{
-			ProductID: item.ProductId,
-			Quantity:  item.Quantity,
+			ProductID: line.ProductID,
+			Quantity:  line.Quantity,
 		})
-		product, err := c.ProductRepo.GetProductByID(item.ProductId)
-		if err != nil {
-			config.Logger.Err(err).Str("product id", item.ProductId).Msg("Error occured while retrieving product for id")
-			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Error creating order"})
-		}
 		productsResponse = append(productsResponse, Product{
-			ID:       product.ID,
-			Name:     product.Name,
-			Price:    product.Price.Price,
-			Category: product.Category.Name,
+			ID:       line.ProductID,
+			Name:     line.Name,
+			Price:    line.UnitPrice,
+			Category: line.Category,
 		})
 	}
 
-	orderResponse := Order{
+	return &Order{
 		ID:       createdOrder.ID,
 		Items:    itemsResponse,
 		Products: productsResponse,
+	}, nil
+}
+
+// validateCoupon looks the coupon code up and checks the limits of its record with checkCoupon.
+func (c *OrderController) validateCoupon(ctx context.Context, couponCode string) (*coupon.Record, *orderError) {
+	if c.CouponGuard != nil {
+		decision := c.CouponGuard.Allow(ctx)
+		if !decision.Allowed {
+			config.LoggerFrom(ctx).Warn().Dur("retry_after", decision.RetryAfter).Msg("Coupon lookup rate limited")
+			return nil, &orderError{
+				status:    http.StatusTooManyRequests,
+				message:   "Too many coupon attempts, try again later",
+				rateLimit: &decision,
+			}
+		}
+	}
+
+	explanation, err := c.FileReader.ExplainPromo(ctx, couponCode)
+	if errors.Is(err, reader.ErrIndexBuilding) {
+		config.LoggerFrom(ctx).Warn().Msg("Coupon indexes are still building")
+		metrics.CouponLookups.WithLabelValues("error").Inc()
+		return nil, &orderError{
+			status:     http.StatusServiceUnavailable,
+			message:    "Coupon validation is temporarily unavailable, coupon codes are still loading",
+			retryAfter: time.Duration(config.AppConfig.Coupon.IndexRetryAfterSeconds) * time.Second,
+		}
+	}
+	if errors.Is(err, reader.ErrReaderUnavailable) {
+		config.LoggerFrom(ctx).Err(err).Msg("Coupon reader is not available")
+		metrics.CouponLookups.WithLabelValues("error").Inc()
+		return nil, &orderError{status: http.StatusServiceUnavailable, message: "Coupon validation is temporarily unavailable"}
+	}
+	if err != nil {
+		config.LoggerFrom(ctx).Err(err).Msg("Coupon code validation failed")
+		metrics.CouponLookups.WithLabelValues("error").Inc()
+		return nil, &orderError{status: http.StatusBadRequest, message: "Coupon code validation failed"}
+	}
+	config.LoggerFrom(ctx).Debug().
+		Bool("valid", explanation.Valid).
+		Str("reason", explanation.Reason).
+		Strs("matched", explanation.Matched).
+		Strs("skipped_by_range", explanation.SkippedByRange).
+		Strs("searched_without_hit", explanation.SearchedWithoutHit).
+		Strs("not_searched", explanation.NotSearched).
+		Msg("Coupon code validated")
+	c.recordCouponResult(ctx, explanation.Valid)
+	if !explanation.Valid {
+		metrics.CouponLookups.WithLabelValues("miss").Inc()
+		return nil, &orderError{status: http.StatusBadRequest, message: "Coupon code is invalid"}
+	}
+
+	record := explanation.Record
+	if orderErr := c.checkCoupon(ctx, record); orderErr != nil {
+		if orderErr.coupon {
+			metrics.CouponLookups.WithLabelValues("inactive").Inc()
+		} else {
+			metrics.CouponLookups.WithLabelValues("error").Inc()
+		}
+		return nil, orderErr
+	}
+	metrics.CouponLookups.WithLabelValues("hit").Inc()
+	return record, nil
+}
+
+// checkCoupon checks the validity period and the uses of a coupon record, the minimum order value
+// needs the priced order and is checked by priceOrder.
+func (c *OrderController) checkCoupon(ctx context.Context, record *coupon.Record) *orderError {
+	if err := record.CheckActive(time.Now()); err != nil {
+		return &orderError{status: http.StatusBadRequest, message: couponMessage(err), coupon: true}
+	}
+	if record.MaxUses > 0 {
+		uses, err := c.OrderRepo.CouponUses(ctx, record.Code)
+		if err != nil {
+			config.LoggerFrom(ctx).Err(err).Msg("Failed to count coupon uses")
+			return &orderError{status: http.StatusInternalServerError, message: "Coupon code validation failed"}
+		}
+		if uses >= record.MaxUses {
+			return &orderError{status: http.StatusBadRequest, message: couponMessage(repository.ErrCouponUsedUp), coupon: true}
+		}
+	}
+	return nil
+}
+
+func couponMessage(err error) string {
+	switch {
+	case errors.Is(err, coupon.ErrExpired):
+		return "Coupon code has expired"
+	case errors.Is(err, coupon.ErrNotYetValid):
+		return "Coupon code is not valid yet"
+	case errors.Is(err, repository.ErrCouponUsedUp):
+		return "Coupon code has been used up"
+	default:
+		return "Coupon code is invalid"
+	}
+}
+
+func (c *OrderController) recordCouponResult(ctx context.Context, valid bool) {
+	if c.CouponGuard != nil {
+		c.CouponGuard.RecordResult(ctx, valid)
+	}
+}
+
+func writeOrderError(ctx *gin.Context, orderErr *orderError) {
+	if orderErr.rateLimit != nil {
+		ratelimit.SetHeaders(ctx.Writer.Header(), *orderErr.rateLimit)
+	}
+	if orderErr.retryAfter > 0 {
+		ctx.Header("Retry-After", strconv.Itoa(int(orderErr.retryAfter.Seconds())))
+	}
+	ctx.JSON(orderErr.status, gin.H{"error": orderErr.message})
+}
+
+// priceItems resolves the products of the given items and prices them with the coupon and its
+// discount rule. The coupon code is not validated here.
+func priceItems(ctx context.Context, productRepo repository.ProductRepository, items []OrderItem, couponCode string, rule coupon.Rule) (*pricing.Quote, *orderError) {
+	lines := make([]pricing.Line, 0, len(items))
+	for _, item := range items {
+		product, err := productRepo.GetProductByID(ctx, item.ProductID)
+		if err != nil {
+			config.LoggerFrom(ctx).Err(err).Str("product id", item.ProductID).Msg("Error occured while retrieving product for id")
+			return nil, &orderError{status: http.StatusBadRequest, message: "failed to price items"}
+		}
+		if product == nil {
+			config.LoggerFrom(ctx).Error().Str("product id", item.ProductID).Msg("Product does not exist for the order item")
+			return nil, &orderError{status: http.StatusBadRequest, message: fmt.Sprintf("product %s not found", item.ProductID)}
+		}
+		lines = append(lines, pricing.Line{
+			ProductID: product.ID,
+			Name:      product.Name,
+			Category:  product.Category.Name,
+			UnitPrice: product.Price.Price,
+			Quantity:  item.Quantity,
+		})
 	}
 
-	ctx.JSON(http.StatusCreated, orderResponse)
+	quote := pricing.Price(lines, couponCode, rule)
+	return &quote, nil
 }
@@ -22,7 +22,7 @@ func NewProductController(productRepo repository.ProductRepository) *ProductCont
 func (p *ProductController) ListProducts(c *gin.Context) {
 	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
 	if err != nil || page < 1 {
-		config.Logger.Info().
+		config.LoggerFrom(c.Request.Context()).Info().
 			Str("page", c.Query("page")).
 			Msg("Invalid page parameter, defaulting to 1")
 		page = 1
@@ -30,16 +30,16 @@ func (p *ProductController) ListProducts(c *gin.Context) {
 
 	limit, err := strconv.Atoi(c.DefaultQuery("limit", "5"))
 	if err != nil || limit <= 0 {
-		config.Logger.Info().
+		config.LoggerFrom(c.Request.Context()).Info().
 			Str("limit", c.Query("limit")).
 			Msg("Invalid limit parameter, defaulting to 5")
 		limit = 5
 	}
 
 	repo := repository.GetProductRepository()
-	pageResult, repoErr := repo.ListProducts(page, limit)
+	pageResult, repoErr := repo.ListProducts(c.Request.Context(), page, limit)
 	if repoErr != nil {
-		config.Logger.Error().
+		config.LoggerFrom(c.Request.Context()).Error().
 			Err(repoErr).
 			Int("page", page).
 			Int("limit", limit).
@@ -70,15 +70,15 @@ func (p *ProductController) GetProductByID(c *gin.Context) {
 	id := c.Param("productId")
 
 	if id == "" {
-		config.Logger.Warn().Msg("Missing product ID parameter")
+		config.LoggerFrom(c.Request.Context()).Warn().Msg("Missing product ID parameter")
 		c.JSON(http.StatusBadRequest, gin.H{"error": "missing product ID"})
 		return
 	}
 
 	repo := repository.GetProductRepository()
-	product, err := repo.GetProductByID(id)
+	product, err := repo.GetProductByID(c.Request.Context(), id)
 	if err != nil {
-		config.Logger.Error().
+		config.LoggerFrom(c.Request.Context()).Error().
 			Err(err).
 			Str("productId", id).
 			Msg("Repository error while fetching product")
@@ -87,7 +87,7 @@ func (p *ProductController) GetProductByID(c *gin.Context) {
 	}
 
 	if product == nil {
-		config.Logger.Warn().Str("productId", id).Msg("Product not found")
+		config.LoggerFrom(c.Request.Context()).Warn().Str("productId", id).Msg("Product not found")
 		c.JSON(http.StatusNotFound, gin.H{"error": "product not found"})
 		return
 	}
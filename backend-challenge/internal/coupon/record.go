@@ -0,0 +1,120 @@
+package coupon
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A coupon file line is either a bare code, or a record of the code followed by tab or comma
+// separated attributes, in this order, any of which may be left empty:
+//
+//	code, discount rule, valid from, valid to, max uses, minimum order value
+//
+// e.g. "SPRING2026\tpercent:10\t2026-03-01\t2026-05-31\t500\t20". Files stay sorted by code,
+// which sorting the whole lines gives since the separators sort before letters and digits.
+
+var (
+	ErrNotYetValid = errors.New("coupon code is not valid yet")
+	ErrExpired     = errors.New("coupon code has expired")
+)
+
+type Record struct {
+	Code          string    `json:"code"`
+	Discount      Rule      `json:"discount,omitzero"`
+	ValidFrom     time.Time `json:"validFrom,omitzero"`
+	ValidTo       time.Time `json:"validTo,omitzero"`
+	MaxUses       int       `json:"maxUses,omitempty"`
+	MinOrderValue float64   `json:"minOrderValue,omitempty"`
+}
+
+// HasAttributes reports whether the record carries more than the code.
+func (r Record) HasAttributes() bool {
+	return r != Record{Code: r.Code}
+}
+
+// CheckActive returns ErrNotYetValid or ErrExpired when the record is not valid at t.
+func (r Record) CheckActive(t time.Time) error {
+	if !r.ValidFrom.IsZero() && t.Before(r.ValidFrom) {
+		return ErrNotYetValid
+	}
+	if !r.ValidTo.IsZero() && t.After(r.ValidTo) {
+		return ErrExpired
+	}
+	return nil
+}
+
+// Key returns the code of a coupon file line, the part the file is sorted and indexed by.
+func Key(line string) string {
+	if i := strings.IndexAny(line, "\t,"); i >= 0 {
+		return strings.TrimSpace(line[:i])
+	}
+	return line
+}
+
+func ParseRecord(line string) (Record, error) {
+	sep := ","
+	if strings.Contains(line, "\t") {
+		sep = "\t"
+	}
+	fields := strings.Split(line, sep)
+	for i := range fields {
+		fields[i] = strings.TrimSpace(fields[i])
+	}
+	if len(fields) > 6 {
+		return Record{}, fmt.Errorf("coupon record %q has %d fields, at most 6 are allowed", line, len(fields))
+	}
+	field := func(i int) string {
+		if i < len(fields) {
+			return fields[i]
+		}
+		return ""
+	}
+
+	record := Record{Code: field(0)}
+	var errs []error
+	var err error
+	if record.Discount, err = ParseRule(field(1)); err != nil {
+		errs = append(errs, err)
+	}
+	if record.ValidFrom, err = parseDate(field(2), false); err != nil {
+		errs = append(errs, fmt.Errorf("valid from: %w", err))
+	}
+	if record.ValidTo, err = parseDate(field(3), true); err != nil {
+		errs = append(errs, fmt.Errorf("valid to: %w", err))
+	}
+	if s := field(4); s != "" {
+		if record.MaxUses, err = strconv.Atoi(s); err != nil || record.MaxUses < 0 {
+			errs = append(errs, fmt.Errorf("max uses %q is not a positive integer", s))
+		}
+	}
+	if s := field(5); s != "" {
+		if record.MinOrderValue, err = strconv.ParseFloat(s, 64); err != nil || record.MinOrderValue < 0 {
+			errs = append(errs, fmt.Errorf("minimum order value %q is not a positive number", s))
+		}
+	}
+	if len(errs) > 0 {
+		return Record{}, fmt.Errorf("invalid coupon record for %s: %w", record.Code, errors.Join(errs...))
+	}
+	return record, nil
+}
+
+// parseDate accepts RFC 3339 times and plain dates. A plain end date includes the whole day, in UTC.
+func parseDate(s string, endOfDay bool) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.DateOnly, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is neither a date nor an RFC 3339 time", s)
+	}
+	if endOfDay {
+		t = t.Add(24*time.Hour - time.Nanosecond)
+	}
+	return t, nil
+}
@@ -0,0 +1,64 @@
+package coupon
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type DiscountKind string
+
+const (
+	// PercentOff takes Value percent off the subtotal.
+	PercentOff DiscountKind = "percent"
+	// AmountOff takes the fixed amount Value off the subtotal.
+	AmountOff DiscountKind = "amount"
+	// CheapestFree makes the lowest priced item in the order free.
+	CheapestFree DiscountKind = "cheapest_free"
+)
+
+// Rule is the discount a coupon gives. The zero Rule leaves the discount to the code, see pricing.
+type Rule struct {
+	Kind  DiscountKind `json:"kind"`
+	Value float64      `json:"value,omitempty"`
+}
+
+func (r Rule) IsZero() bool {
+	return r == Rule{}
+}
+
+func (r Rule) String() string {
+	if r.Kind == CheapestFree || r.IsZero() {
+		return string(r.Kind)
+	}
+	return string(r.Kind) + ":" + strconv.FormatFloat(r.Value, 'f', -1, 64)
+}
+
+// ParseRule parses "percent:18", "amount:5.50" or "cheapest_free". An empty rule is the zero Rule.
+func ParseRule(s string) (Rule, error) {
+	if s == "" {
+		return Rule{}, nil
+	}
+	kind, value, hasValue := strings.Cut(s, ":")
+	rule := Rule{Kind: DiscountKind(strings.ToLower(kind))}
+
+	switch rule.Kind {
+	case CheapestFree:
+		if hasValue {
+			return Rule{}, fmt.Errorf("discount rule %q takes no value", s)
+		}
+		return rule, nil
+	case PercentOff, AmountOff:
+		v, err := strconv.ParseFloat(value, 64)
+		if !hasValue || err != nil || v <= 0 {
+			return Rule{}, fmt.Errorf("discount rule %q needs a positive value, like %s:10", s, rule.Kind)
+		}
+		if rule.Kind == PercentOff && v > 100 {
+			return Rule{}, fmt.Errorf("discount rule %q is more than 100 percent", s)
+		}
+		rule.Value = v
+		return rule, nil
+	default:
+		return Rule{}, fmt.Errorf("unknown discount rule %q, use percent:N, amount:N or cheapest_free", s)
+	}
+}
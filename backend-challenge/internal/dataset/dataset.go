@@ -0,0 +1,511 @@
+// Package dataset generates synthetic coupon files for tests and benchmarks. The same options and
+// seed always give the same files, so runs on generated data can be compared without copying
+// production coupon files around.
+//
+// Every file holds Codes distinct codes. An Overlap share of the codes of each file is shared with
+// at least one other file, the rest is found in that file alone. The manifest written next to the
+// files records which codes are valid, found in at least MinFiles files as the default policy
+// requires, which are invalid, found in fewer files, and codes that are in no file at all.
+//
+// The files are written as the codes are drawn, only the codes listed in the manifest are held in
+// memory, so datasets far larger than memory can be generated. Sorted files are sorted with an
+// external sort.
+package dataset
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/bits"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/dekanayake/kart-challenge/backend-challenge/internal/extsort"
+)
+
+// ManifestFile is the name of the manifest written next to the coupon files.
+const ManifestFile = "manifest.json"
+
+// maxFiles is the number of files the membership bit mask of a code can hold.
+const maxFiles = 64
+
+type Options struct {
+	Seed  int64 `json:"seed"`
+	Files int   `json:"files"`
+	// Codes per file. When 0, FileSize is used to work it out from the average line length.
+	Codes    int   `json:"codes"`
+	FileSize int64 `json:"fileSize,omitempty"`
+	// MinLength and MaxLength bound the code lengths, 8 to 10 characters as orders accept them.
+	MinLength int    `json:"minLength"`
+	MaxLength int    `json:"maxLength"`
+	Charset   string `json:"charset"`
+	// Overlap is the share, 0 to 1, of the codes of each file that are also in other files.
+	Overlap float64 `json:"overlap"`
+	// MinFiles is the number of files a code must be in to be listed as valid.
+	MinFiles int `json:"minFiles"`
+	// Unsorted leaves the lines in the random order they were drawn in, to exercise the sort.
+	Unsorted bool `json:"unsorted"`
+	// BlockSize greater than 0 writes block-gzip files, named couponbaseN.gz.
+	BlockSize int `json:"blockSize,omitempty"`
+	// Samples is the number of codes of each kind listed in the manifest.
+	Samples int `json:"samples"`
+}
+
+func DefaultOptions() Options {
+	return Options{
+		Seed:      1,
+		Files:     3,
+		Codes:     100_000,
+		MinLength: 8,
+		MaxLength: 10,
+		Charset:   "ABCDEFGHIJKLMNOPQRSTUVWXYZ",
+		Overlap:   0.5,
+		MinFiles:  2,
+		Samples:   100,
+	}
+}
+
+func (o Options) Validate() error {
+	if o.Files <= 0 || o.Files > maxFiles {
+		return fmt.Errorf("files must be 1 to %d, got %d", maxFiles, o.Files)
+	}
+	if o.Codes < 0 || o.FileSize < 0 || (o.Codes == 0 && o.FileSize == 0) {
+		return fmt.Errorf("codes or file size must be greater than 0")
+	}
+	if o.MinLength <= 0 || o.MaxLength < o.MinLength {
+		return fmt.Errorf("code lengths must be 1 or more with the minimum not above the maximum, got %d to %d", o.MinLength, o.MaxLength)
+	}
+	if o.Charset == "" {
+		return fmt.Errorf("charset must not be empty")
+	}
+	for _, c := range []byte(o.Charset) {
+		if c <= ' ' || c >= 0x7f {
+			return fmt.Errorf("charset may only hold printable ASCII characters, got %q", c)
+		}
+	}
+	if o.Overlap < 0 || o.Overlap > 1 {
+		return fmt.Errorf("overlap must be 0 to 1, got %g", o.Overlap)
+	}
+	if o.MinFiles <= 0 {
+		return fmt.Errorf("min files must be greater than 0, got %d", o.MinFiles)
+	}
+	if o.BlockSize < 0 || o.Samples < 0 {
+		return fmt.Errorf("block size and samples must not be negative")
+	}
+	if o.Unsorted && o.BlockSize > 0 {
+		return fmt.Errorf("unsorted files can not be block-gzip, the sort reads plain files")
+	}
+	return nil
+}
+
+// codesPerFile is Codes, or the number of lines of the average length that fit in FileSize.
+func (o Options) codesPerFile() int {
+	if o.Codes > 0 {
+		return o.Codes
+	}
+	average := float64(o.MinLength+o.MaxLength)/2 + 1
+	return max(1, int(float64(o.FileSize)/average))
+}
+
+type FileInfo struct {
+	Name  string `json:"name"`
+	Codes int    `json:"codes"`
+	Bytes int64  `json:"bytes"`
+}
+
+// Code is a code with the names of the files holding it.
+type Code struct {
+	Code  string   `json:"code"`
+	Files []string `json:"files"`
+}
+
+type Manifest struct {
+	Options  Options    `json:"options"`
+	Files    []FileInfo `json:"files"`
+	Distinct int        `json:"distinct"`
+	// ValidCount codes are in at least MinFiles files, InvalidCount codes in fewer.
+	ValidCount   int `json:"validCount"`
+	InvalidCount int `json:"invalidCount"`
+	// Valid, Invalid and Absent list up to Samples codes of each kind, Absent codes are in no file.
+	Valid   []Code   `json:"valid"`
+	Invalid []Code   `json:"invalid"`
+	Absent  []string `json:"absent"`
+}
+
+// Paths returns the paths of the coupon files in dir.
+func (m *Manifest) Paths(dir string) []string {
+	paths := make([]string, len(m.Files))
+	for i, f := range m.Files {
+		paths[i] = filepath.Join(dir, f.Name)
+	}
+	return paths
+}
+
+// sortChunkSize bounds the memory the external sort of a file takes. A chunk of short codes takes
+// several times its bytes in memory, so the files are sorted one chunk at a time.
+const sortChunkSize = 8 * 1024 * 1024
+
+// capacity is the number of distinct codes the lengths and charset allow, capped to avoid overflow.
+func (o Options) capacity() float64 {
+	total := 0.0
+	for length := o.MinLength; length <= o.MaxLength && total < math.MaxInt64; length++ {
+		total += math.Pow(float64(len(o.Charset)), float64(length))
+	}
+	return total
+}
+
+// Generate writes the coupon files and the manifest to dir, creating it when needed.
+func Generate(dir string, opts Options) (*Manifest, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	perFile := opts.codesPerFile()
+	// a length runs out of codes once most of them are drawn, keep room in every length drawn
+	if need := float64(perFile*opts.Files + opts.Samples); need*2 > opts.capacity() {
+		return nil, fmt.Errorf("%d codes of %d to %d characters of %q are not enough for %.0f distinct codes",
+			int64(min(opts.capacity(), math.MaxInt64)), opts.MinLength, opts.MaxLength, opts.Charset, need)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	names := make([]string, opts.Files)
+	for i := range names {
+		names[i] = "couponbase" + strconv.Itoa(i+1)
+		if opts.BlockSize > 0 {
+			names[i] += ".gz"
+		}
+	}
+
+	// the files each code is in are drawn twice from the same seed, first to count the valid and
+	// invalid codes so the samples can be spread over them, then to write the codes
+	m := &Manifest{Options: opts, Valid: []Code{}, Invalid: []Code{}, Absent: []string{}}
+	counter := newAssigner(opts, perFile)
+	for mask, ok := counter.next(); ok; mask, ok = counter.next() {
+		m.Distinct++
+		if bits.OnesCount64(mask) >= opts.MinFiles {
+			m.ValidCount++
+		} else {
+			m.InvalidCount++
+		}
+	}
+
+	files, err := createFiles(dir, names, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer files.remove()
+
+	// the samples are spread over the codes, the unique codes of every file are drawn one file after the other
+	validSamples := newSampler(m.ValidCount, opts.Samples)
+	invalidSamples := newSampler(m.InvalidCount, opts.Samples)
+	source := newCodeSource(opts)
+	assigner := newAssigner(opts, perFile)
+	for mask, ok := assigner.next(); ok; mask, ok = assigner.next() {
+		code := source.next()
+		if err := files.write(code, mask); err != nil {
+			return nil, err
+		}
+		if bits.OnesCount64(mask) >= opts.MinFiles {
+			if validSamples.take() {
+				m.Valid = append(m.Valid, Code{Code: code, Files: fileNames(mask, names)})
+			}
+		} else if invalidSamples.take() {
+			m.Invalid = append(m.Invalid, Code{Code: code, Files: fileNames(mask, names)})
+		}
+	}
+	for range opts.Samples {
+		m.Absent = append(m.Absent, source.next())
+	}
+
+	if m.Files, err = files.finish(dir, opts); err != nil {
+		return nil, err
+	}
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(dir, ManifestFile), append(data, '\n'), 0o644); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// assigner draws the files each code is in. Shared codes go to 2 or more random files that still
+// need shared codes, until every file has its Overlap share or one file is left needing them. The
+// files are then filled up with codes of their own, one file after the other.
+type assigner struct {
+	opts       Options
+	rng        *rand.Rand
+	perFile    int
+	needed     []int
+	filled     []int
+	candidates []int
+	// file is the file being filled up with its own codes, -1 while shared codes are drawn
+	file int
+}
+
+func newAssigner(opts Options, perFile int) *assigner {
+	a := &assigner{
+		opts:       opts,
+		rng:        rand.New(rand.NewSource(opts.Seed)),
+		perFile:    perFile,
+		needed:     make([]int, opts.Files),
+		filled:     make([]int, opts.Files),
+		candidates: make([]int, 0, opts.Files),
+		file:       -1,
+	}
+	if opts.Files > 1 {
+		for f := range a.needed {
+			a.needed[f] = int(math.Round(opts.Overlap * float64(perFile)))
+		}
+	}
+	return a
+}
+
+// next returns the files of the next code as a bit mask, false once every file is full.
+func (a *assigner) next() (uint64, bool) {
+	if a.file < 0 {
+		a.candidates = a.candidates[:0]
+		for f, n := range a.needed {
+			if n > 0 {
+				a.candidates = append(a.candidates, f)
+			}
+		}
+		if len(a.candidates) >= 2 {
+			a.rng.Shuffle(len(a.candidates), func(i, j int) {
+				a.candidates[i], a.candidates[j] = a.candidates[j], a.candidates[i]
+			})
+			k := min(len(a.candidates), 2+a.rng.Intn(a.opts.Files-1))
+			var mask uint64
+			for _, f := range a.candidates[:k] {
+				mask |= 1 << f
+				a.needed[f]--
+				a.filled[f]++
+			}
+			return mask, true
+		}
+		a.file = 0
+	}
+	for ; a.file < a.opts.Files; a.file++ {
+		if a.filled[a.file] < a.perFile {
+			a.filled[a.file]++
+			return 1 << a.file, true
+		}
+	}
+	return 0, false
+}
+
+// codeSource draws distinct codes without remembering them. The length of a code is drawn at
+// random, and the code is the next one of a seeded permutation of the codes of that length.
+type codeSource struct {
+	opts  Options
+	rng   *rand.Rand
+	perms []permutation
+	drawn []uint64
+	buf   []byte
+}
+
+func newCodeSource(opts Options) *codeSource {
+	s := &codeSource{
+		opts: opts,
+		// a source of its own, so the codes do not depend on how the files were drawn
+		rng:   rand.New(rand.NewSource(opts.Seed ^ 0x5eed)),
+		drawn: make([]uint64, opts.MaxLength-opts.MinLength+1),
+	}
+	for length := opts.MinLength; length <= opts.MaxLength; length++ {
+		size := uint64(math.MaxInt64)
+		if count := math.Pow(float64(len(opts.Charset)), float64(length)); count < float64(size) {
+			size = uint64(count)
+		}
+		s.perms = append(s.perms, newPermutation(size, s.rng.Uint64()))
+	}
+	return s
+}
+
+// next returns a code no earlier call returned. A length with every code drawn is passed over for
+// the next one, Generate checked there are enough codes.
+func (s *codeSource) next() string {
+	i := s.rng.Intn(len(s.perms))
+	for s.drawn[i] == s.perms[i].size {
+		i = (i + 1) % len(s.perms)
+	}
+	n := s.perms[i].at(s.drawn[i])
+	s.drawn[i]++
+
+	charset := s.opts.Charset
+	s.buf = s.buf[:0]
+	for range s.opts.MinLength + i {
+		s.buf = append(s.buf, charset[n%uint64(len(charset))])
+		n /= uint64(len(charset))
+	}
+	return string(s.buf)
+}
+
+// permutation is a seeded bijection of [0, size): a Feistel network over the smallest even number
+// of bits that holds size, walked again until it lands below size.
+type permutation struct {
+	size     uint64
+	halfBits uint
+	seed     uint64
+}
+
+func newPermutation(size, seed uint64) permutation {
+	halfBits := uint(1)
+	for size > 1<<(2*halfBits) {
+		halfBits++
+	}
+	return permutation{size: size, halfBits: halfBits, seed: seed}
+}
+
+func (p permutation) at(i uint64) uint64 {
+	mask := uint64(1)<<p.halfBits - 1
+	for {
+		left, right := i>>p.halfBits, i&mask
+		for round := range uint64(4) {
+			left, right = right, left^(mix(p.seed+round, right)&mask)
+		}
+		i = left<<p.halfBits | right
+		if i < p.size {
+			return i
+		}
+	}
+}
+
+// mix is the splitmix64 finalizer of seed and value.
+func mix(seed, value uint64) uint64 {
+	z := seed + value*0x9e3779b97f4a7c15
+	z = (z ^ z>>30) * 0xbf58476d1ce4e5b9
+	z = (z ^ z>>27) * 0x94d049bb133111eb
+	return z ^ z>>31
+}
+
+// sampler picks n of total items evenly spaced, or all of them when there are not more than n.
+type sampler struct {
+	total, n, seen, picked int
+}
+
+func newSampler(total, n int) *sampler {
+	return &sampler{total: total, n: n}
+}
+
+// take reports whether the next item is picked.
+func (s *sampler) take() bool {
+	seen := s.seen
+	s.seen++
+	if s.total <= s.n {
+		return true
+	}
+	if s.picked < s.n && seen == s.picked*s.total/s.n {
+		s.picked++
+		return true
+	}
+	return false
+}
+
+func fileNames(mask uint64, names []string) []string {
+	var files []string
+	for f, name := range names {
+		if mask&(1<<f) != 0 {
+			files = append(files, name)
+		}
+	}
+	return files
+}
+
+// fileSet holds the open files the codes are written to: the coupon files themselves when they
+// are unsorted, otherwise temp files sorted into the coupon files by finish.
+type fileSet struct {
+	names  []string
+	files  []*os.File
+	writer []*bufio.Writer
+	codes  []int
+}
+
+func createFiles(dir string, names []string, opts Options) (*fileSet, error) {
+	fs := &fileSet{names: names}
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		if !opts.Unsorted {
+			path += ".unsorted"
+		}
+		f, err := os.Create(path)
+		if err != nil {
+			fs.remove()
+			return nil, err
+		}
+		fs.files = append(fs.files, f)
+		fs.writer = append(fs.writer, bufio.NewWriter(f))
+		fs.codes = append(fs.codes, 0)
+	}
+	return fs, nil
+}
+
+func (fs *fileSet) write(code string, mask uint64) error {
+	for f, w := range fs.writer {
+		if mask&(1<<f) == 0 {
+			continue
+		}
+		if _, err := w.WriteString(code + "\n"); err != nil {
+			return err
+		}
+		fs.codes[f]++
+	}
+	return nil
+}
+
+// finish flushes the files, sorts them into the coupon files unless they are unsorted, and
+// returns what was written.
+func (fs *fileSet) finish(dir string, opts Options) ([]FileInfo, error) {
+	infos := make([]FileInfo, 0, len(fs.files))
+	for i, f := range fs.files {
+		if err := fs.writer[i].Flush(); err != nil {
+			return nil, err
+		}
+		if err := f.Close(); err != nil {
+			return nil, err
+		}
+		path := filepath.Join(dir, fs.names[i])
+		if !opts.Unsorted {
+			sortOpts := extsort.DefaultOptions()
+			sortOpts.ChunkSize, sortOpts.Workers, sortOpts.MemoryBudget = sortChunkSize, 1, sortChunkSize
+			sortOpts.BlockSize = opts.BlockSize
+			if _, err := extsort.Sort(f.Name(), path, sortOpts); err != nil {
+				return nil, fmt.Errorf("failed to sort %s: %w", fs.names[i], err)
+			}
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, FileInfo{Name: fs.names[i], Codes: fs.codes[i], Bytes: info.Size()})
+	}
+	return infos, nil
+}
+
+// remove closes the files and removes the temp files of sorted coupon files.
+func (fs *fileSet) remove() {
+	for _, f := range fs.files {
+		f.Close()
+		if filepath.Ext(f.Name()) == ".unsorted" {
+			os.Remove(f.Name())
+		}
+	}
+}
+
+// LoadManifest reads the manifest Generate wrote to dir.
+func LoadManifest(dir string) (*Manifest, error) {
+	data, err := os.ReadFile(filepath.Join(dir, ManifestFile))
+	if err != nil {
+		return nil, err
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("%s: %w", ManifestFile, err)
+	}
+	return &m, nil
+}
@@ -0,0 +1,129 @@
+package extsort_test
+
+import (
+	"bufio"
+	"container/heap"
+	"os"
+	"sort"
+)
+
+// baselineSort is ExternalSort of utils/sort_file.go before chunks were sorted concurrently, kept
+// as the baseline of BenchmarkSort: every chunk is read, sorted and written in turn on one goroutine,
+// then all the chunks are merged in a single pass.
+func baselineSort(inputPath, outputPath string, chunkSize int) error {
+	input, err := os.Open(inputPath)
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+
+	var tempFiles []string
+	defer func() {
+		for _, f := range tempFiles {
+			os.Remove(f)
+		}
+	}()
+	scanner := bufio.NewScanner(input)
+	var lines []string
+	currentSize := 0
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		lines = append(lines, line)
+		currentSize += len(line)
+		if currentSize >= chunkSize {
+			tmp, err := baselineChunk(lines)
+			if err != nil {
+				return err
+			}
+			tempFiles = append(tempFiles, tmp)
+			lines = nil
+			currentSize = 0
+		}
+	}
+	if len(lines) > 0 {
+		tmp, err := baselineChunk(lines)
+		if err != nil {
+			return err
+		}
+		tempFiles = append(tempFiles, tmp)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	return baselineMerge(tempFiles, outputPath)
+}
+
+func baselineChunk(lines []string) (string, error) {
+	sort.Strings(lines)
+	tmp, err := os.CreateTemp("", "chunk-*.txt")
+	if err != nil {
+		return "", err
+	}
+	defer tmp.Close()
+
+	w := bufio.NewWriter(tmp)
+	for _, l := range lines {
+		_, _ = w.WriteString(l + "\n")
+	}
+	return tmp.Name(), w.Flush()
+}
+
+func baselineMerge(files []string, outputPath string) error {
+	out, err := os.Create(outputPath)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	w := bufio.NewWriter(out)
+
+	h := &baselineHeap{}
+	for _, path := range files {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		sc := bufio.NewScanner(f)
+		if sc.Scan() {
+			heap.Push(h, &baselineRun{scanner: sc, file: f, value: sc.Text()})
+		}
+	}
+	defer func() {
+		for _, fs := range *h {
+			fs.file.Close()
+		}
+	}()
+
+	for h.Len() > 0 {
+		fs := heap.Pop(h).(*baselineRun)
+		_, _ = w.WriteString(fs.value + "\n")
+		if fs.scanner.Scan() {
+			fs.value = fs.scanner.Text()
+			heap.Push(h, fs)
+		} else {
+			fs.file.Close()
+		}
+	}
+	return w.Flush()
+}
+
+// baselineRun is the next line of a sorted chunk, baselineHeap orders them for the merge.
+type baselineRun struct {
+	scanner *bufio.Scanner
+	file    *os.File
+	value   string
+}
+
+type baselineHeap []*baselineRun
+
+func (h baselineHeap) Len() int           { return len(h) }
+func (h baselineHeap) Less(i, j int) bool { return h[i].value < h[j].value }
+func (h baselineHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *baselineHeap) Push(x any)        { *h = append(*h, x.(*baselineRun)) }
+func (h *baselineHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
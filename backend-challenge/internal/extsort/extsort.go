@@ -0,0 +1,461 @@
+// Package extsort sorts files too large for memory: chunks are sorted in memory concurrently,
+// written to temp files and merged with a k-way merge, in several passes when there are more
+// chunks than files that may be open at once. Lines can be normalized and deduplicated on the way,
+// and the output can be written as block-gzip.
+package extsort
+
+import (
+	"bufio"
+	"container/heap"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/dekanayake/kart-challenge/backend-challenge/internal/blockgz"
+)
+
+// Options tune Sort.
+type Options struct {
+	// ChunkSize is the number of bytes of lines sorted in memory at once.
+	ChunkSize int
+	// Workers is the number of chunks sorted and written concurrently, and of concurrent merges.
+	Workers int
+	// MemoryBudget bounds the bytes of chunks held at once, it is at least one chunk.
+	MemoryBudget int
+	// MaxOpenFiles is the most sorted files merged in one pass.
+	MaxOpenFiles int
+	// BlockSize greater than 0 writes the output as block-gzip with blocks of about that many bytes.
+	BlockSize int
+
+	// Trim removes the spaces around the line and around the code of a record line.
+	Trim bool
+	// FoldCase upper cases the code, the attributes of a record line keep their case.
+	FoldCase bool
+	// DropBlank drops empty lines, after trimming when Trim is set.
+	DropBlank bool
+	// Dedupe drops lines equal to the line before them in the sorted output.
+	Dedupe bool
+}
+
+func DefaultOptions() Options {
+	return Options{
+		ChunkSize:    100 * 1024 * 1024,
+		Workers:      runtime.NumCPU(),
+		MemoryBudget: 1024 * 1024 * 1024,
+		MaxOpenFiles: 256,
+	}
+}
+
+// Validate returns every option out of range.
+func (o Options) Validate() error {
+	var errs []error
+	if o.ChunkSize <= 0 {
+		errs = append(errs, errors.New("chunk size must be greater than 0"))
+	}
+	if o.Workers <= 0 {
+		errs = append(errs, errors.New("workers must be greater than 0"))
+	}
+	if o.MemoryBudget <= 0 {
+		errs = append(errs, errors.New("memory budget must be greater than 0"))
+	}
+	if o.MaxOpenFiles < 2 {
+		errs = append(errs, errors.New("max open files must be at least 2"))
+	}
+	if o.BlockSize < 0 {
+		errs = append(errs, errors.New("block size must not be negative"))
+	}
+	return errors.Join(errs...)
+}
+
+// Stats account for the lines of one sort.
+type Stats struct {
+	LinesRead int `json:"linesRead"`
+	// Trimmed and CaseFolded lines were changed but kept.
+	Trimmed    int `json:"trimmed"`
+	CaseFolded int `json:"caseFolded"`
+	// BlankDropped and DuplicatesDropped lines are not in the output.
+	BlankDropped      int `json:"blankDropped"`
+	DuplicatesDropped int `json:"duplicatesDropped"`
+	LinesWritten      int `json:"linesWritten"`
+}
+
+func (s Stats) Print(w io.Writer) {
+	fmt.Fprintf(w, "Summary:\n")
+	fmt.Fprintf(w, "  lines read:         %d\n", s.LinesRead)
+	fmt.Fprintf(w, "  trimmed (kept):     %d\n", s.Trimmed)
+	fmt.Fprintf(w, "  case folded (kept): %d\n", s.CaseFolded)
+	fmt.Fprintf(w, "  blank dropped:      %d\n", s.BlankDropped)
+	fmt.Fprintf(w, "  duplicates dropped: %d\n", s.DuplicatesDropped)
+	fmt.Fprintf(w, "  lines written:      %d\n", s.LinesWritten)
+}
+
+// Reconcile checks the line counts of the input and output files against the stats, every
+// difference between them must be explained by a dropped line.
+func (s Stats) Reconcile(inputLines, outputLines int) error {
+	var errs []error
+	if inputLines != s.LinesRead {
+		errs = append(errs, fmt.Errorf("input has %d lines but %d were read", inputLines, s.LinesRead))
+	}
+	if outputLines != s.LinesWritten {
+		errs = append(errs, fmt.Errorf("output has %d lines but %d were written", outputLines, s.LinesWritten))
+	}
+	if kept := s.LinesRead - s.BlankDropped - s.DuplicatesDropped; kept != s.LinesWritten {
+		errs = append(errs, fmt.Errorf("%d lines read less %d blank and %d duplicates dropped is %d, but %d were written, %d lines are unaccounted for",
+			s.LinesRead, s.BlankDropped, s.DuplicatesDropped, kept, s.LinesWritten, kept-s.LinesWritten))
+	}
+	return errors.Join(errs...)
+}
+
+// normalize applies the line options to one input line, it returns false when the line is dropped.
+func (o Options) normalize(line string, stats *Stats) (string, bool) {
+	if o.Trim {
+		trimmed := strings.TrimSpace(line)
+		if i := strings.IndexAny(trimmed, "\t,"); i >= 0 {
+			trimmed = strings.TrimSpace(trimmed[:i]) + trimmed[i:]
+		}
+		if trimmed != line {
+			stats.Trimmed++
+			line = trimmed
+		}
+	}
+	if o.DropBlank && strings.TrimSpace(line) == "" {
+		stats.BlankDropped++
+		return "", false
+	}
+	if o.FoldCase {
+		end := len(line)
+		if i := strings.IndexAny(line, "\t,"); i >= 0 {
+			end = i
+		}
+		if code := strings.ToUpper(line[:end]); code != line[:end] {
+			stats.CaseFolded++
+			line = code + line[end:]
+		}
+	}
+	return line, true
+}
+
+// CountLines counts the lines of a plain or block-gzip file.
+func CountLines(path string) (int, error) {
+	compressed, err := blockgz.IsBlockGzip(path)
+	if err != nil {
+		return 0, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if compressed {
+		gz, err := blockgz.NewReader(f)
+		if err != nil {
+			return 0, err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	scanner := bufio.NewScanner(r)
+	count := 0
+	for scanner.Scan() {
+		count++
+	}
+	return count, scanner.Err()
+}
+
+// Sort splits, sorts, and merges a large file without loading it fully into memory.
+// Chunks are read on one goroutine and sorted on opts.Workers goroutines, and at most
+// opts.MemoryBudget / opts.ChunkSize chunks are in memory at once. With one worker and a budget of
+// one chunk it reads, sorts and writes each chunk in turn.
+func Sort(inputPath, outputPath string, opts Options) (Stats, error) {
+	var stats Stats
+	tempFiles, err := writeSortedChunks(inputPath, opts, &stats)
+	defer func() {
+		for _, f := range tempFiles {
+			os.Remove(f)
+		}
+	}()
+	if err != nil {
+		return stats, err
+	}
+
+	// merge in passes until one pass can merge every file into the output
+	for len(tempFiles) > opts.MaxOpenFiles {
+		merged, dropped, err := mergePass(tempFiles, opts)
+		stats.DuplicatesDropped += dropped
+		for _, f := range tempFiles {
+			os.Remove(f)
+		}
+		tempFiles = merged
+		if err != nil {
+			return stats, err
+		}
+	}
+	written, dropped, err := mergeSortedFiles(tempFiles, outputPath, opts.BlockSize, opts.Dedupe)
+	stats.LinesWritten = written
+	stats.DuplicatesDropped += dropped
+	return stats, err
+}
+
+// writeSortedChunks reads the input into chunks and sorts and writes them concurrently. It returns
+// the temp files written, also on error so the caller can remove them. The lines read, changed and
+// dropped are counted in stats.
+func writeSortedChunks(inputPath string, opts Options, stats *Stats) ([]string, error) {
+	input, err := os.Open(inputPath)
+	if err != nil {
+		return nil, err
+	}
+	defer input.Close()
+
+	inFlight := max(1, opts.MemoryBudget/opts.ChunkSize)
+	// a token is taken before a chunk is read and given back once it is written
+	tokens := make(chan struct{}, inFlight)
+	chunks := make(chan []string)
+	done := make(chan struct{})
+
+	var (
+		mu        sync.Mutex
+		tempFiles []string
+		errs      []error
+		wg        sync.WaitGroup
+		failOnce  sync.Once
+	)
+	fail := func(err error) {
+		mu.Lock()
+		errs = append(errs, err)
+		mu.Unlock()
+		failOnce.Do(func() { close(done) })
+	}
+
+	for range min(opts.Workers, inFlight) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for lines := range chunks {
+				tmp, err := writeSortedChunk(lines)
+				<-tokens
+				if tmp != "" {
+					mu.Lock()
+					tempFiles = append(tempFiles, tmp)
+					mu.Unlock()
+				}
+				if err != nil {
+					fail(err)
+				}
+			}
+		}()
+	}
+
+	scanner := bufio.NewScanner(input)
+	var lines []string
+	currentSize := 0
+	send := func() bool {
+		select {
+		case chunks <- lines:
+		case <-done:
+			return false
+		}
+		lines = nil
+		currentSize = 0
+		return true
+	}
+	// acquire waits for room in the memory budget before the next chunk is read
+	acquire := func() bool {
+		select {
+		case tokens <- struct{}{}:
+			return true
+		case <-done:
+			return false
+		}
+	}
+
+	// Split into sorted chunks
+	ok := acquire()
+	for ok && scanner.Scan() {
+		stats.LinesRead++
+		line, keep := opts.normalize(scanner.Text(), stats)
+		if !keep {
+			continue
+		}
+		lines = append(lines, line)
+		currentSize += len(line)
+		if currentSize >= opts.ChunkSize {
+			ok = send() && acquire()
+		}
+	}
+	if ok && len(lines) > 0 {
+		send()
+	} else if ok {
+		<-tokens
+	}
+	close(chunks)
+	wg.Wait()
+
+	if err := scanner.Err(); err != nil {
+		errs = append(errs, err)
+	}
+	sort.Strings(tempFiles)
+	return tempFiles, errors.Join(errs...)
+}
+
+func writeSortedChunk(lines []string) (string, error) {
+	sort.Strings(lines)
+	tmp, err := os.CreateTemp("", "chunk-*.txt")
+	if err != nil {
+		return "", err
+	}
+	defer tmp.Close()
+
+	w := bufio.NewWriter(tmp)
+	for _, l := range lines {
+		_, _ = w.WriteString(l + "\n")
+	}
+	return tmp.Name(), w.Flush()
+}
+
+// mergePass merges the files in groups of opts.MaxOpenFiles into temp files, up to opts.Workers
+// groups at a time. It returns the merged files, also on error so the caller can remove them, and
+// the number of duplicates dropped.
+func mergePass(files []string, opts Options) ([]string, int, error) {
+	var groups [][]string
+	for len(files) > 0 {
+		n := min(opts.MaxOpenFiles, len(files))
+		groups = append(groups, files[:n])
+		files = files[n:]
+	}
+
+	merged := make([]string, len(groups))
+	dropped := make([]int, len(groups))
+	errs := make([]error, len(groups))
+	sem := make(chan struct{}, opts.Workers)
+	var wg sync.WaitGroup
+	for i, group := range groups {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			tmp, err := os.CreateTemp("", "merge-*.txt")
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			tmp.Close()
+			merged[i] = tmp.Name()
+			_, dropped[i], errs[i] = mergeSortedFiles(group, tmp.Name(), 0, opts.Dedupe)
+		}()
+	}
+	wg.Wait()
+
+	out := make([]string, 0, len(merged))
+	total := 0
+	for i, f := range merged {
+		if f != "" {
+			out = append(out, f)
+		}
+		total += dropped[i]
+	}
+	return out, total, errors.Join(errs...)
+}
+
+type fileScanner struct {
+	scanner *bufio.Scanner
+	file    *os.File
+	value   string
+}
+
+type fileHeap []*fileScanner
+
+func (h fileHeap) Len() int           { return len(h) }
+func (h fileHeap) Less(i, j int) bool { return h[i].value < h[j].value }
+func (h fileHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *fileHeap) Push(x interface{}) {
+	*h = append(*h, x.(*fileScanner))
+}
+func (h *fileHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
+
+// mergeSortedFiles merges sorted files into outputPath. It returns the number of lines written and,
+// with dedupe, of the repeated lines dropped.
+func mergeSortedFiles(files []string, outputPath string, blockSize int, dedupe bool) (written, dropped int, err error) {
+	out, err := os.Create(outputPath)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer out.Close()
+	buffered := bufio.NewWriter(out)
+
+	var writer io.StringWriter = buffered
+	var blocks *blockgz.Writer
+	if blockSize > 0 {
+		blocks = blockgz.NewWriter(buffered, blockSize)
+		writer = blocks
+	}
+
+	h := &fileHeap{}
+	defer func() {
+		for _, fs := range *h {
+			fs.file.Close()
+		}
+	}()
+
+	for _, path := range files {
+		f, err := os.Open(path)
+		if err != nil {
+			return 0, 0, err
+		}
+		sc := bufio.NewScanner(f)
+		if sc.Scan() {
+			fs := &fileScanner{scanner: sc, file: f, value: sc.Text()}
+			heap.Push(h, fs)
+			continue
+		}
+		f.Close()
+		if err := sc.Err(); err != nil {
+			return written, dropped, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+	}
+
+	last := ""
+	for h.Len() > 0 {
+		fs := heap.Pop(h).(*fileScanner)
+		if dedupe && written > 0 && fs.value == last {
+			dropped++
+		} else {
+			_, _ = writer.WriteString(fs.value + "\n")
+			written++
+			last = fs.value
+		}
+
+		if fs.scanner.Scan() {
+			fs.value = fs.scanner.Text()
+			heap.Push(h, fs)
+			continue
+		}
+		fs.file.Close()
+		// a file that ends on an error would silently cut the output short
+		if err := fs.scanner.Err(); err != nil {
+			return written, dropped, fmt.Errorf("failed to read %s: %w", fs.file.Name(), err)
+		}
+	}
+
+	if blocks != nil {
+		if err := blocks.Close(); err != nil {
+			return written, dropped, err
+		}
+	}
+	return written, dropped, buffered.Flush()
+}
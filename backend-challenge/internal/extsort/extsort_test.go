@@ -0,0 +1,95 @@
+package extsort_test
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"testing"
+
+	"github.com/dekanayake/kart-challenge/backend-challenge/internal/dataset"
+	"github.com/dekanayake/kart-challenge/backend-challenge/internal/extsort"
+)
+
+// benchmarkLines is about 20MB of coupon codes, sorted in 256KB chunks into about 70 runs. The
+// runs are merged in one pass with benchmarkMaxOpenFiles open files, and in two passes with
+// benchmarkMultiLevelOpenFiles.
+const (
+	benchmarkLines               = 2_000_000
+	benchmarkCodeLength          = 9
+	benchmarkChunkSize           = 256 * 1024
+	benchmarkMaxOpenFiles        = 256
+	benchmarkMultiLevelOpenFiles = 16
+)
+
+func writeBenchmarkInput(b *testing.B) string {
+	b.Helper()
+	opts := dataset.DefaultOptions()
+	opts.Files, opts.Codes, opts.MinLength, opts.MaxLength, opts.Unsorted = 1, benchmarkLines, benchmarkCodeLength, benchmarkCodeLength, true
+	dir := b.TempDir()
+	m, err := dataset.Generate(dir, opts)
+	if err != nil {
+		b.Fatal(err)
+	}
+	// the chunk size counts the bytes of the lines without their line ends
+	if runs := benchmarkLines * benchmarkCodeLength / benchmarkChunkSize; runs <= benchmarkMultiLevelOpenFiles {
+		b.Fatalf("%d runs are merged in one pass with %d open files", runs, benchmarkMultiLevelOpenFiles)
+	}
+	return m.Paths(dir)[0]
+}
+
+// BenchmarkSort compares the sort before the pipeline, baselineSort, with the parallel sort on 1,
+// 2, 4 and the number of CPUs workers, merging in one pass and in two. More workers than CPUs only
+// overlap reading with sorting, the speedup of sorting chunks concurrently needs as many cores.
+//
+//	go test ./internal/extsort -run x -bench Sort -benchtime 5x
+func BenchmarkSort(b *testing.B) {
+	input := writeBenchmarkInput(b)
+
+	b.Run("baseline", func(b *testing.B) {
+		output := filepath.Join(b.TempDir(), "sorted")
+		for b.Loop() {
+			if err := baselineSort(input, output, benchmarkChunkSize); err != nil {
+				b.Fatal(err)
+			}
+		}
+		b.StopTimer()
+		checkSorted(b, output)
+	})
+
+	workers := []int{1, 2, 4}
+	if !slices.Contains(workers, runtime.NumCPU()) {
+		workers = append(workers, runtime.NumCPU())
+	}
+	for _, w := range workers {
+		for _, maxOpenFiles := range []int{benchmarkMaxOpenFiles, benchmarkMultiLevelOpenFiles} {
+			opts := extsort.Options{
+				ChunkSize:    benchmarkChunkSize,
+				Workers:      w,
+				MemoryBudget: 4 * w * benchmarkChunkSize,
+				MaxOpenFiles: maxOpenFiles,
+			}
+			b.Run(fmt.Sprintf("workers=%d/max-open-files=%d", w, maxOpenFiles), func(b *testing.B) {
+				output := filepath.Join(b.TempDir(), "sorted")
+				for b.Loop() {
+					if _, err := extsort.Sort(input, output, opts); err != nil {
+						b.Fatal(err)
+					}
+				}
+				b.StopTimer()
+				checkSorted(b, output)
+			})
+		}
+	}
+}
+
+func checkSorted(b *testing.B, output string) {
+	b.Helper()
+	lines, err := extsort.CountLines(output)
+	if err != nil {
+		b.Fatal(err)
+	}
+	if lines != benchmarkLines {
+		b.Fatalf("sorted %d lines, want %d", lines, benchmarkLines)
+	}
+}
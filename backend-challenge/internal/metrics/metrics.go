@@ -0,0 +1,89 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "kart"
+
+var (
+	HTTPRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by method, route template and status.",
+	}, []string{"method", "route", "status"})
+
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by method, route template and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	CouponSearchDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "coupon_search_duration_seconds",
+		Help:      "Latency of a coupon code search across all coupon files.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	})
+
+	// CouponSearchFiles counts the coupon files per search, scanned or skipped by the firstKey/lastKey range filter.
+	CouponSearchFiles = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "coupon_search_files_total",
+		Help:      "Coupon files scanned or skipped by the key range filter during coupon searches.",
+	}, []string{"outcome"})
+
+	CouponSearchWorkers = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "coupon_search_workers",
+		Help:      "Size of the coupon search worker pool.",
+	})
+
+	CouponSearchWorkersBusy = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "coupon_search_workers_busy",
+		Help:      "Coupon search workers currently searching a file.",
+	})
+
+	CouponIndexEntries = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "coupon_index_entries",
+		Help:      "Number of partial index entries per coupon file.",
+	}, []string{"file"})
+
+	// CouponCacheLookups counts coupon lookups served by the cache (hit), searched (miss) or
+	// joined to the same search already running (shared).
+	CouponCacheLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "coupon_cache_lookups_total",
+		Help:      "Coupon lookups by cache result.",
+	}, []string{"result"})
+
+	CouponCacheEntries = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "coupon_cache_entries",
+		Help:      "Coupon lookup results held in the cache.",
+	})
+
+	CouponCacheInvalidations = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "coupon_cache_invalidations_total",
+		Help:      "Coupon cache purges, after an index rebuild or from the admin API.",
+	})
+
+	OrdersCreated = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "orders_created_total",
+		Help:      "Orders created.",
+	})
+
+	// CouponLookups counts coupon validations by result: hit, miss, inactive (expired, not yet valid
+	// or used up) or error.
+	CouponLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "coupon_lookups_total",
+		Help:      "Coupon code validations by result.",
+	}, []string{"result"})
+)
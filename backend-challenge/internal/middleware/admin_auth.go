@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/dekanayake/kart-challenge/backend-challenge/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+// AdminAuth only lets requests through whose api_key header matches the admin API key.
+func AdminAuth(adminAPIKey string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		apiKey := c.GetHeader(APIKeyHeader)
+		if apiKey == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "missing api key"})
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(apiKey), []byte(adminAPIKey)) != 1 {
+			config.LoggerFrom(c.Request.Context()).Warn().
+				Str("client_ip", c.ClientIP()).
+				Str("path", c.Request.URL.Path).
+				Msg("Rejected admin request with invalid api key")
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			return
+		}
+		c.Next()
+	}
+}
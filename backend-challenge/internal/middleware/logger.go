@@ -16,7 +16,7 @@ func ZerologMiddleware() gin.HandlerFunc {
 		latency := time.Since(start)
 		status := c.Writer.Status()
 
-		config.Logger.Info().
+		config.LoggerFrom(c.Request.Context()).Info().
 			Str("method", c.Request.Method).
 			Str("path", c.Request.URL.Path).
 			Str("queryParams", c.Request.URL.RawQuery).
@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/dekanayake/kart-challenge/backend-challenge/internal/config"
+	"github.com/dekanayake/kart-challenge/backend-challenge/internal/ratelimit"
+	"github.com/gin-gonic/gin"
+)
+
+// APIKeyHeader is the header carrying the API key, as defined in the OpenAPI spec.
+const APIKeyHeader = "api_key"
+
+// RateLimitKeys identifies the caller by client IP and, when it sends one of the known API keys, by
+// that key, and stores the keys in the request context for the rate limiters further down the chain.
+// Other API keys are ignored, otherwise anyone could use up or lock out the budget of a key.
+func RateLimitKeys(apiKeys ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		keys := []string{"ip:" + c.ClientIP()}
+		if apiKey := c.GetHeader(APIKeyHeader); apiKey != "" && knownAPIKey(apiKey, apiKeys) {
+			keys = append(keys, "key:"+apiKey)
+		}
+		c.Request = c.Request.WithContext(ratelimit.WithKeys(c.Request.Context(), keys))
+		c.Next()
+	}
+}
+
+// RateLimit rejects the request with 429 when the caller has used up its budget in the limiter.
+func RateLimit(name string, limiter *ratelimit.Limiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		decision := limiter.Allow(ratelimit.KeysFrom(c.Request.Context())...)
+		ratelimit.SetHeaders(c.Writer.Header(), decision)
+
+		if !decision.Allowed {
+			config.LoggerFrom(c.Request.Context()).Warn().
+				Str("limiter", name).
+				Str("client_ip", c.ClientIP()).
+				Dur("retry_after", decision.RetryAfter).
+				Msg("Rate limit exceeded")
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "Too many requests, try again later"})
+			return
+		}
+		c.Next()
+	}
+}
+
+func knownAPIKey(apiKey string, apiKeys []string) bool {
+	for _, known := range apiKeys {
+		if known != "" && subtle.ConstantTimeCompare([]byte(apiKey), []byte(known)) == 1 {
+			return true
+		}
+	}
+	return false
+}
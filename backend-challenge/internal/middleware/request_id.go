@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"github.com/dekanayake/kart-challenge/backend-challenge/internal/config"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength caps the length of request ids taken from callers, so a client cannot
+// blow up every log line of its request.
+const maxRequestIDLength = 128
+
+// RequestID accepts the X-Request-ID of the caller or generates one, echoes it in the response and
+// stores a logger carrying the id, and the trace id when the request is traced, in the request context.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader(RequestIDHeader)
+		if !validRequestID(requestID) {
+			requestID = uuid.NewString()
+		}
+		c.Header(RequestIDHeader, requestID)
+
+		logCtx := config.Logger.With().Str("request_id", requestID)
+		if spanCtx := trace.SpanContextFromContext(c.Request.Context()); spanCtx.HasTraceID() {
+			logCtx = logCtx.Str("trace_id", spanCtx.TraceID().String())
+		}
+		logger := logCtx.Logger()
+
+		c.Request = c.Request.WithContext(logger.WithContext(c.Request.Context()))
+		c.Next()
+	}
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		if r < '!' || r > '~' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,99 @@
+package pricing
+
+import (
+	"math"
+	"strings"
+
+	"github.com/dekanayake/kart-challenge/backend-challenge/internal/coupon"
+)
+
+const (
+	HappyHoursCoupon = "HAPPYHOURS"
+	BuyGetOneCoupon  = "BUYGETONE"
+)
+
+// builtinRules are the discounts of the codes that predate coupon records.
+var builtinRules = map[string]coupon.Rule{
+	HappyHoursCoupon: {Kind: coupon.PercentOff, Value: 18},
+	BuyGetOneCoupon:  {Kind: coupon.CheapestFree},
+}
+
+type Line struct {
+	ProductID string
+	Name      string
+	Category  string
+	UnitPrice float64
+	Quantity  int
+}
+
+type PricedLine struct {
+	Line
+	LineTotal float64
+}
+
+type Quote struct {
+	Lines      []PricedLine
+	CouponCode string
+	Subtotal   float64
+	Discount   float64
+	Total      float64
+}
+
+// Price calculates line totals, subtotal, coupon discount and order total.
+// The coupon code is expected to be validated by the caller already. The discount comes from
+// the rule of the coupon record, or from the code when the rule is zero. Codes without either
+// are accepted but do not change the total.
+func Price(lines []Line, couponCode string, rule coupon.Rule) Quote {
+	quote := Quote{
+		Lines:      make([]PricedLine, 0, len(lines)),
+		CouponCode: couponCode,
+	}
+
+	for _, line := range lines {
+		lineTotal := roundCents(line.UnitPrice * float64(line.Quantity))
+		quote.Lines = append(quote.Lines, PricedLine{
+			Line:      line,
+			LineTotal: lineTotal,
+		})
+		quote.Subtotal += lineTotal
+	}
+	quote.Subtotal = roundCents(quote.Subtotal)
+
+	if rule.IsZero() {
+		rule = builtinRules[strings.ToUpper(couponCode)]
+	}
+	quote.Discount = math.Min(discount(lines, quote.Subtotal, rule), quote.Subtotal)
+	quote.Total = roundCents(quote.Subtotal - quote.Discount)
+
+	return quote
+}
+
+func discount(lines []Line, subtotal float64, rule coupon.Rule) float64 {
+	switch rule.Kind {
+	case coupon.PercentOff:
+		return roundCents(subtotal * rule.Value / 100)
+	case coupon.AmountOff:
+		return roundCents(rule.Value)
+	case coupon.CheapestFree:
+		// lowest priced item in the order is free
+		lowest := -1.0
+		for _, line := range lines {
+			if line.Quantity <= 0 {
+				continue
+			}
+			if lowest < 0 || line.UnitPrice < lowest {
+				lowest = line.UnitPrice
+			}
+		}
+		if lowest < 0 {
+			return 0
+		}
+		return roundCents(lowest)
+	default:
+		return 0
+	}
+}
+
+func roundCents(v float64) float64 {
+	return math.Round(v*100) / 100
+}
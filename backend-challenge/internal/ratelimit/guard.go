@@ -0,0 +1,73 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type contextKey struct{}
+
+// WithKeys stores the rate limit keys of the caller in the context, so code deeper in the
+// request, like coupon validation, can be limited per caller.
+func WithKeys(ctx context.Context, keys []string) context.Context {
+	return context.WithValue(ctx, contextKey{}, keys)
+}
+
+func KeysFrom(ctx context.Context) []string {
+	keys, _ := ctx.Value(contextKey{}).([]string)
+	return keys
+}
+
+// CouponGuard limits coupon lookups per caller and locks callers out after repeated
+// invalid coupon guesses.
+type CouponGuard struct {
+	limiter *Limiter
+	lockout *Lockout
+}
+
+func NewCouponGuard(limiter *Limiter, lockout *Lockout) *CouponGuard {
+	return &CouponGuard{
+		limiter: limiter,
+		lockout: lockout,
+	}
+}
+
+// Allow checks the lockout of the caller first, so a locked out caller does not use up lookup tokens.
+func (g *CouponGuard) Allow(ctx context.Context) Decision {
+	keys := KeysFrom(ctx)
+	if locked := g.lockout.LockedFor(keys...); locked > 0 {
+		return Decision{
+			Allowed:    false,
+			Limit:      int(g.limiter.burst),
+			Reset:      locked,
+			RetryAfter: locked,
+		}
+	}
+	return g.limiter.Allow(keys...)
+}
+
+func (g *CouponGuard) RecordResult(ctx context.Context, valid bool) {
+	keys := KeysFrom(ctx)
+	if valid {
+		g.lockout.RecordSuccess(keys...)
+		return
+	}
+	g.lockout.RecordFailure(keys...)
+}
+
+// SetHeaders writes the RateLimit-* headers, and Retry-After when the request was rejected.
+func SetHeaders(h http.Header, d Decision) {
+	h.Set("RateLimit-Limit", strconv.Itoa(d.Limit))
+	h.Set("RateLimit-Remaining", strconv.Itoa(d.Remaining))
+	h.Set("RateLimit-Reset", strconv.Itoa(seconds(d.Reset)))
+	if !d.Allowed {
+		h.Set("Retry-After", strconv.Itoa(max(seconds(d.RetryAfter), 1)))
+	}
+}
+
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,36 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCouponGuardLockedOutTakesNoToken(t *testing.T) {
+	clock := newFakeClock()
+	// a token a minute, so the lockout does not refill the bucket
+	limiter := NewLimiter(1, 2)
+	limiter.now = clock.now
+	lockout := NewLockout(1, 30*time.Second, time.Minute)
+	lockout.now = clock.now
+	guard := NewCouponGuard(limiter, lockout)
+	ctx := WithKeys(context.Background(), []string{"ip:a", "key:k"})
+
+	if d := guard.Allow(ctx); !d.Allowed || d.Remaining != 1 {
+		t.Fatalf("first lookup: allowed %t, remaining %d, want allowed with 1 left", d.Allowed, d.Remaining)
+	}
+	guard.RecordResult(ctx, false)
+
+	for range 3 {
+		d := guard.Allow(ctx)
+		if d.Allowed || d.RetryAfter != 30*time.Second {
+			t.Fatalf("locked out lookup: allowed %t, retry after %s, want denied for 30s", d.Allowed, d.RetryAfter)
+		}
+	}
+
+	clock.advance(30 * time.Second)
+	// the token left by the first lookup is still there
+	if d := guard.Allow(ctx); !d.Allowed || d.Remaining != 0 {
+		t.Fatalf("lookup after the lockout: allowed %t, remaining %d, want allowed with 0 left", d.Allowed, d.Remaining)
+	}
+}
@@ -0,0 +1,112 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// idleBucketTTL is how long a bucket can stay unused before it is dropped. A dropped bucket
+// is recreated full, which is the state it would have reached by then anyway.
+const idleBucketTTL = 10 * time.Minute
+
+// Decision is the outcome of a rate limit check, with the numbers needed for the RateLimit-* headers.
+type Decision struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration // until the bucket is full again
+	RetryAfter time.Duration // until the next request is allowed, zero when allowed
+}
+
+type bucket struct {
+	tokens   float64
+	lastSeen time.Time
+}
+
+// Limiter is a token bucket rate limiter keyed by an arbitrary string, such as client IP or API key.
+// Every key gets a bucket holding up to burst tokens, refilled at ratePerMinute.
+type Limiter struct {
+	mu        sync.Mutex
+	rate      float64 // tokens per second
+	burst     float64
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func NewLimiter(ratePerMinute, burst int) *Limiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &Limiter{
+		rate:    float64(ratePerMinute) / 60,
+		burst:   float64(burst),
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+// Allow takes one token from the bucket of every key when all of them have one, a request denied
+// by one bucket uses up no token of the others. The returned decision is the one of the most
+// restrictive bucket.
+func (l *Limiter) Allow(keys ...string) Decision {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweepLocked(now)
+
+	buckets := make([]*bucket, len(keys))
+	allowed := true
+	for i, key := range keys {
+		buckets[i] = l.refillLocked(key, now)
+		if buckets[i].tokens < 1 {
+			allowed = false
+		}
+	}
+
+	result := Decision{Allowed: allowed, Limit: int(l.burst), Remaining: int(l.burst)}
+	for _, b := range buckets {
+		if allowed {
+			b.tokens--
+		} else if b.tokens < 1 {
+			result.RetryAfter = max(result.RetryAfter, l.durationFor(1-b.tokens))
+		}
+		result.Remaining = min(result.Remaining, int(math.Floor(b.tokens)))
+		result.Reset = max(result.Reset, l.durationFor(l.burst-b.tokens))
+	}
+	return result
+}
+
+// refillLocked returns the bucket of the key with the tokens refilled since it was last seen.
+func (l *Limiter) refillLocked(key string, now time.Time) *bucket {
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, lastSeen: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.lastSeen).Seconds()*l.rate)
+	b.lastSeen = now
+	return b
+}
+
+// durationFor returns how long it takes to refill the given number of tokens.
+func (l *Limiter) durationFor(tokens float64) time.Duration {
+	if l.rate <= 0 {
+		return time.Duration(math.MaxInt64)
+	}
+	return time.Duration(tokens / l.rate * float64(time.Second))
+}
+
+func (l *Limiter) sweepLocked(now time.Time) {
+	if now.Sub(l.lastSweep) < idleBucketTTL {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		if now.Sub(b.lastSeen) > idleBucketTTL {
+			delete(l.buckets, key)
+		}
+	}
+}
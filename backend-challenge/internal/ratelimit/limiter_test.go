@@ -0,0 +1,117 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+// fakeClock is the clock of the limiters under test, it only moves when advanced.
+type fakeClock struct {
+	t time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{t: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) now() time.Time { return c.t }
+
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+type limiterStep struct {
+	advance       time.Duration
+	keys          []string
+	wantAllowed   bool
+	wantRemaining int
+	wantRetry     time.Duration
+}
+
+func runLimiterSteps(t *testing.T, l *Limiter, clock *fakeClock, steps []limiterStep) {
+	t.Helper()
+	for i, step := range steps {
+		clock.advance(step.advance)
+		d := l.Allow(step.keys...)
+		if d.Allowed != step.wantAllowed || d.Remaining != step.wantRemaining || d.RetryAfter != step.wantRetry {
+			t.Fatalf("step %d: Allow(%v) = allowed %t, remaining %d, retry after %s, want %t, %d, %s",
+				i+1, step.keys, d.Allowed, d.Remaining, d.RetryAfter, step.wantAllowed, step.wantRemaining, step.wantRetry)
+		}
+	}
+}
+
+func TestLimiterRefillAndBurst(t *testing.T) {
+	ip := []string{"ip:a"}
+	tests := []struct {
+		name  string
+		steps []limiterStep
+	}{
+		{"burst then denied", []limiterStep{
+			{0, ip, true, 2, 0},
+			{0, ip, true, 1, 0},
+			{0, ip, true, 0, 0},
+			{0, ip, false, 0, time.Second},
+		}},
+		{"partial refill is not a token", []limiterStep{
+			{0, ip, true, 2, 0},
+			{0, ip, true, 1, 0},
+			{0, ip, true, 0, 0},
+			{500 * time.Millisecond, ip, false, 0, 500 * time.Millisecond},
+			{500 * time.Millisecond, ip, true, 0, 0},
+		}},
+		{"refill stops at the burst", []limiterStep{
+			{0, ip, true, 2, 0},
+			{time.Hour, ip, true, 2, 0},
+			{0, ip, true, 1, 0},
+		}},
+		{"keys have their own buckets", []limiterStep{
+			{0, ip, true, 2, 0},
+			{0, ip, true, 1, 0},
+			{0, ip, true, 0, 0},
+			{0, []string{"ip:b"}, true, 2, 0},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := newFakeClock()
+			// a token a second
+			l := NewLimiter(60, 3)
+			l.now = clock.now
+			runLimiterSteps(t, l, clock, tt.steps)
+		})
+	}
+}
+
+func TestLimiterDeniedTakesNoToken(t *testing.T) {
+	both := []string{"ip:a", "key:k"}
+	tests := []struct {
+		name  string
+		steps []limiterStep
+	}{
+		{"key denies, ip keeps its tokens", []limiterStep{
+			{0, []string{"key:k"}, true, 1, 0},
+			{0, []string{"key:k"}, true, 0, 0},
+			{0, both, false, 0, time.Second},
+			{0, []string{"ip:a"}, true, 1, 0},
+			{0, []string{"ip:a"}, true, 0, 0},
+		}},
+		{"ip denies, key keeps its tokens", []limiterStep{
+			{0, []string{"ip:a"}, true, 1, 0},
+			{0, []string{"ip:a"}, true, 0, 0},
+			{0, both, false, 0, time.Second},
+			{0, both, false, 0, time.Second},
+			{0, []string{"key:k"}, true, 1, 0},
+		}},
+		{"allowed takes from every bucket", []limiterStep{
+			{0, both, true, 1, 0},
+			{0, []string{"ip:a"}, true, 0, 0},
+			{0, []string{"key:k"}, true, 0, 0},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := newFakeClock()
+			l := NewLimiter(60, 2)
+			l.now = clock.now
+			runLimiterSteps(t, l, clock, tt.steps)
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+type failureRecord struct {
+	failures    int
+	lockedUntil time.Time
+	lastFailure time.Time
+	// lastForgiven is when a success last forgave a failure
+	lastForgiven time.Time
+}
+
+// Lockout tracks failed attempts per key and locks the key out once the threshold is reached.
+// Every further failure doubles the lockout period, up to maxLockout. A success forgives one failure
+// once the last failure and the last forgiven one are baseLockout old, so valid codes sent between
+// guesses do not keep a caller below the threshold. Failures older than maxLockout are forgotten.
+type Lockout struct {
+	mu          sync.Mutex
+	threshold   int
+	baseLockout time.Duration
+	maxLockout  time.Duration
+	records     map[string]*failureRecord
+	lastSweep   time.Time
+	now         func() time.Time
+}
+
+func NewLockout(threshold int, baseLockout, maxLockout time.Duration) *Lockout {
+	if threshold < 1 {
+		threshold = 1
+	}
+	return &Lockout{
+		threshold:   threshold,
+		baseLockout: baseLockout,
+		maxLockout:  maxLockout,
+		records:     make(map[string]*failureRecord),
+		now:         time.Now,
+	}
+}
+
+// LockedFor returns how long the longest locked of the keys stays locked, zero when none is locked.
+func (l *Lockout) LockedFor(keys ...string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	var longest time.Duration
+	for _, key := range keys {
+		r, ok := l.records[key]
+		if !ok {
+			continue
+		}
+		if remaining := r.lockedUntil.Sub(now); remaining > longest {
+			longest = remaining
+		}
+	}
+	return longest
+}
+
+// RecordFailure counts a failed attempt for every key and returns the longest resulting lockout.
+func (l *Lockout) RecordFailure(keys ...string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweepLocked(now)
+
+	var longest time.Duration
+	for _, key := range keys {
+		r, ok := l.records[key]
+		if !ok || now.Sub(r.lastFailure) > l.maxLockout {
+			r = &failureRecord{}
+			l.records[key] = r
+		}
+		r.failures++
+		r.lastFailure = now
+
+		if r.failures >= l.threshold {
+			lockout := l.lockoutFor(r.failures - l.threshold)
+			r.lockedUntil = now.Add(lockout)
+			if lockout > longest {
+				longest = lockout
+			}
+		}
+	}
+	return longest
+}
+
+func (l *Lockout) RecordSuccess(keys ...string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	for _, key := range keys {
+		r, ok := l.records[key]
+		if !ok || now.Before(r.lockedUntil) ||
+			now.Sub(r.lastFailure) < l.baseLockout || now.Sub(r.lastForgiven) < l.baseLockout {
+			continue
+		}
+		r.lastForgiven = now
+		if r.failures--; r.failures == 0 {
+			delete(l.records, key)
+		}
+	}
+}
+
+func (l *Lockout) lockoutFor(exponent int) time.Duration {
+	lockout := l.baseLockout
+	for i := 0; i < exponent; i++ {
+		lockout *= 2
+		if lockout >= l.maxLockout {
+			return l.maxLockout
+		}
+	}
+	return min(lockout, l.maxLockout)
+}
+
+func (l *Lockout) sweepLocked(now time.Time) {
+	if now.Sub(l.lastSweep) < idleBucketTTL {
+		return
+	}
+	l.lastSweep = now
+	for key, r := range l.records {
+		if now.Sub(r.lastFailure) > l.maxLockout && now.After(r.lockedUntil) {
+			delete(l.records, key)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLockoutDoubling(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxLockout time.Duration
+		want       []time.Duration // the lockout after each failure
+	}{
+		{"doubles up to the max", 4 * time.Minute, []time.Duration{
+			0, 0, 30 * time.Second, time.Minute, 2 * time.Minute, 4 * time.Minute, 4 * time.Minute,
+		}},
+		{"max between two doublings", 100 * time.Second, []time.Duration{
+			0, 0, 30 * time.Second, time.Minute, 100 * time.Second, 100 * time.Second,
+		}},
+		{"max equal to the base", 30 * time.Second, []time.Duration{
+			0, 0, 30 * time.Second, 30 * time.Second,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := newFakeClock()
+			l := NewLockout(3, 30*time.Second, tt.maxLockout)
+			l.now = clock.now
+			for i, want := range tt.want {
+				if got := l.RecordFailure("ip:a"); got != want {
+					t.Fatalf("failure %d: locked out for %s, want %s", i+1, got, want)
+				}
+				if got := l.LockedFor("ip:a", "ip:b"); got != want {
+					t.Fatalf("failure %d: LockedFor = %s, want %s", i+1, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestLockoutForgivesOneFailurePerBaseLockout(t *testing.T) {
+	type step struct {
+		advance      time.Duration
+		fail         bool // a failure, otherwise a success
+		wantFailures int
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{"not right after a failure", []step{
+			{0, true, 1},
+			{0, true, 2},
+			{10 * time.Second, false, 2},
+			{19 * time.Second, false, 2},
+			{time.Second, false, 1},
+		}},
+		{"once per base lockout", []step{
+			{0, true, 1},
+			{0, true, 2},
+			{30 * time.Second, false, 1},
+			{time.Second, false, 1},
+			{28 * time.Second, false, 1},
+			{time.Second, false, 0},
+			{time.Hour, false, 0},
+		}},
+		{"not while locked out", []step{
+			{0, true, 1},
+			{0, true, 2},
+			{0, true, 3},
+			// locked for 30s from the third failure
+			{29 * time.Second, false, 3},
+			{2 * time.Second, false, 2},
+		}},
+		{"successes between guesses do not hold the caller below the threshold", []step{
+			{0, true, 1},
+			{time.Second, false, 1},
+			{time.Second, true, 2},
+			{time.Second, false, 2},
+			{time.Second, true, 3},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := newFakeClock()
+			l := NewLockout(3, 30*time.Second, time.Hour)
+			l.now = clock.now
+			for i, s := range tt.steps {
+				clock.advance(s.advance)
+				if s.fail {
+					l.RecordFailure("ip:a")
+				} else {
+					l.RecordSuccess("ip:a")
+				}
+				failures := 0
+				if r, ok := l.records["ip:a"]; ok {
+					failures = r.failures
+				}
+				if failures != s.wantFailures {
+					t.Fatalf("step %d: %d failures, want %d", i+1, failures, s.wantFailures)
+				}
+			}
+		})
+	}
+}
+
+func TestLockoutForgetsOldFailures(t *testing.T) {
+	clock := newFakeClock()
+	l := NewLockout(2, 30*time.Second, time.Minute)
+	l.now = clock.now
+
+	l.RecordFailure("ip:a")
+	clock.advance(time.Minute + time.Second)
+	if got := l.RecordFailure("ip:a"); got != 0 {
+		t.Fatalf("a failure after maxLockout locked out for %s, want the first one forgotten", got)
+	}
+}
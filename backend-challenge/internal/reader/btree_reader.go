@@ -0,0 +1,93 @@
+package reader
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/dekanayake/kart-challenge/backend-challenge/internal/btree"
+	"github.com/dekanayake/kart-challenge/backend-challenge/internal/coupon"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// newBTreeFileReader searches the coupon files through their multi-level on-disk indexes, written
+// offline to btree/<file>.btree next to them by kartctl sort -btree or kartctl index btree. Only the
+// root page of each index is loaded at startup, so the memory does not grow with the files, and a
+// lookup reads one index page per level below the root and at most a stride or block of the file.
+//
+// It is an HDD reader whose indexes are loaded instead of built, with the same range filter, policy,
+// worker pool and admin rebuild, which reloads the indexes after they were rebuilt offline. The index
+// build checked the files are sorted, so strict mode does not apply. A file without an index, or
+// changed since its index was built, fails the reader.
+func newBTreeFileReader(opts Options) (*HDDFileReader, error) {
+	return newIndexedFileReader(opts, func() ([]*fileBuild, error) {
+		return findCouponFiles(opts.RootPath)
+	}, loadTreeIndex)
+}
+
+// loadTreeIndex opens the on-disk index of a coupon file, the stride is the one it was built with.
+func loadTreeIndex(path string, _ stride, _ bool, bytesIndexed *atomic.Int64) (*fileIndex, error) {
+	start := time.Now()
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	indexPath := btree.IndexPath(path)
+	tree, err := btree.Open(indexPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the index, build it with kartctl index btree: %w", err)
+	}
+	if err := tree.Check(info); err != nil {
+		return nil, fmt.Errorf("%s: %w, rebuild it with kartctl index btree", indexPath, err)
+	}
+	bytesIndexed.Store(info.Size())
+
+	ti := tree.Info()
+	st := stride{mode: StrideBytes, bytes: ti.Stride}
+	if ti.BlockGzip {
+		st = stride{mode: strideBlock}
+	}
+	return &fileIndex{
+		path:          path,
+		firstKey:      ti.FirstKey,
+		lastKey:       ti.LastKey,
+		stride:        st,
+		blockGzip:     ti.BlockGzip,
+		tree:          tree,
+		fileSize:      info.Size(),
+		fileModTime:   info.ModTime(),
+		builtAt:       ti.BuiltAt,
+		buildDuration: time.Since(start),
+	}, nil
+}
+
+// searchPromoInTree finds where the promo would be through the index pages and reads the file from
+// there until it passes the promo.
+func searchPromoInTree(ctx context.Context, file *os.File, fi *fileIndex, promo string) (*coupon.Record, error) {
+	span := trace.SpanFromContext(ctx)
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	// the offsets of the index are only right for the file it was built for
+	if err := fi.tree.Check(info); err != nil {
+		return nil, err
+	}
+	offset, reads, err := fi.tree.Seek(promo)
+	span.SetAttributes(attribute.Int("coupon.btree.page_reads", reads))
+	if err != nil {
+		return nil, err
+	}
+	if fi.blockGzip {
+		return searchPromoInBlocks(ctx, file, offset, promo)
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return scanForPromo(ctx, bufio.NewReaderSize(file, int(min(max(fi.stride.bytes, 4096), 1<<20))), promo)
+}
@@ -0,0 +1,244 @@
+package reader
+
+import (
+	"container/list"
+	"context"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dekanayake/kart-challenge/backend-challenge/internal/config"
+	"github.com/dekanayake/kart-challenge/backend-challenge/internal/metrics"
+	"golang.org/x/sync/singleflight"
+)
+
+// CacheAdmin is implemented by readers that cache lookup results.
+type CacheAdmin interface {
+	CacheStats() CacheStats
+	// Purge drops every cached result, the next lookup of each code searches the files again.
+	Purge()
+	// Uncached returns the wrapped reader, which searches the files on every lookup.
+	Uncached() FileReader
+}
+
+// CacheOptions bounds a CachingFileReader.
+type CacheOptions struct {
+	// Size is the number of lookup results kept, the least recently used is dropped first.
+	Size int
+	// PositiveTTL keeps valid codes, NegativeTTL invalid codes, zero does not cache them.
+	PositiveTTL time.Duration
+	NegativeTTL time.Duration
+}
+
+// ConfigCacheOptions returns the cache options of the coupon configuration.
+func ConfigCacheOptions(cfg config.CouponCacheConfig) CacheOptions {
+	return CacheOptions{
+		Size:        cfg.Size,
+		PositiveTTL: time.Duration(cfg.PositiveTTLSeconds) * time.Second,
+		NegativeTTL: time.Duration(cfg.NegativeTTLSeconds) * time.Second,
+	}
+}
+
+// CacheStats counts the lookups of a caching reader since it started.
+type CacheStats struct {
+	// Hits were answered from the cache, Misses searched the files and Shared waited for the search
+	// of the same code another lookup had started.
+	Hits   uint64 `json:"hits"`
+	Misses uint64 `json:"misses"`
+	Shared uint64 `json:"shared"`
+	// Entries is the number of results held, expired ones included until they are looked up or evicted.
+	Entries       int    `json:"entries"`
+	Size          int    `json:"size"`
+	Invalidations uint64 `json:"invalidations"`
+}
+
+// CachingFileReader serves repeated lookups of the same code from memory. Valid and invalid
+// decisions are kept for their own TTL in an LRU bounded by size, lookups of a code that is being
+// searched wait for that search instead of starting their own, and failed searches are not cached.
+// A successful index rebuild of the wrapped reader purges the cache, so it never outlives the coupon
+// files it was filled from.
+type CachingFileReader struct {
+	next FileReader
+	opts CacheOptions
+
+	mu sync.Mutex
+	// lru holds *cacheEntry, the front is the most recently used
+	lru     *list.List
+	entries map[string]*list.Element
+	// generation changes on every purge, a search started before it is not cached after it
+	generation uint64
+
+	group                               singleflight.Group
+	hits, misses, shared, invalidations atomic.Uint64
+	now                                 func() time.Time
+}
+
+type cacheEntry struct {
+	promo       string
+	explanation Explanation
+	expires     time.Time
+}
+
+// NewCachingFileReader wraps next with a cache. The returned reader administers the indexes of
+// next when next does.
+func NewCachingFileReader(next FileReader, opts CacheOptions) FileReader {
+	c := &CachingFileReader{
+		next:    next,
+		opts:    opts,
+		lru:     list.New(),
+		entries: make(map[string]*list.Element),
+		now:     time.Now,
+	}
+	if admin, ok := next.(IndexAdmin); ok {
+		return &cachingIndexAdmin{CachingFileReader: c, admin: admin}
+	}
+	return c
+}
+
+func (c *CachingFileReader) SearchPromo(ctx context.Context, promo string) (bool, error) {
+	explanation, err := c.ExplainPromo(ctx, promo)
+	return explanation.Valid, err
+}
+
+// ExplainPromo returns the cached explanation of the promo while it is fresh. The explanation is
+// shared by every lookup it answers and must not be modified.
+func (c *CachingFileReader) ExplainPromo(ctx context.Context, promo string) (Explanation, error) {
+	explanation, generation, ok := c.get(promo)
+	if ok {
+		c.hits.Add(1)
+		metrics.CouponCacheLookups.WithLabelValues("hit").Inc()
+		return explanation, nil
+	}
+
+	// the generation is part of the key, a lookup made after a purge never joins a search made before it
+	key := strconv.FormatUint(generation, 10) + ":" + promo
+	// only the lookup that runs the search runs its function
+	searched := false
+	results := c.group.DoChan(key, func() (any, error) {
+		searched = true
+		c.misses.Add(1)
+		metrics.CouponCacheLookups.WithLabelValues("miss").Inc()
+		// the search is shared, a caller giving up must not cancel it for the others
+		explanation, err := c.next.ExplainPromo(context.WithoutCancel(ctx), promo)
+		if err == nil {
+			c.put(promo, explanation, generation)
+		}
+		return explanation, err
+	})
+	select {
+	case res := <-results:
+		if !searched {
+			c.shared.Add(1)
+			metrics.CouponCacheLookups.WithLabelValues("shared").Inc()
+		}
+		return res.Val.(Explanation), res.Err
+	case <-ctx.Done():
+		return newExplanation(promo), ctx.Err()
+	}
+}
+
+func (c *CachingFileReader) Status() Status {
+	return c.next.Status()
+}
+
+// get returns the fresh cached explanation of the promo, and the current generation.
+func (c *CachingFileReader) get(promo string) (Explanation, uint64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[promo]
+	if !ok {
+		return Explanation{}, c.generation, false
+	}
+	entry := elem.Value.(*cacheEntry)
+	if c.now().After(entry.expires) {
+		c.removeLocked(elem)
+		return Explanation{}, c.generation, false
+	}
+	c.lru.MoveToFront(elem)
+	return entry.explanation, c.generation, true
+}
+
+// put caches the explanation of a search made in generation, unless the cache was purged since.
+func (c *CachingFileReader) put(promo string, explanation Explanation, generation uint64) {
+	ttl := c.opts.NegativeTTL
+	if explanation.Valid {
+		ttl = c.opts.PositiveTTL
+	}
+	if ttl <= 0 || c.opts.Size <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if generation != c.generation {
+		return
+	}
+	entry := &cacheEntry{promo: promo, explanation: explanation, expires: c.now().Add(ttl)}
+	if elem, ok := c.entries[promo]; ok {
+		elem.Value = entry
+		c.lru.MoveToFront(elem)
+		return
+	}
+	c.entries[promo] = c.lru.PushFront(entry)
+	for c.lru.Len() > c.opts.Size {
+		c.removeLocked(c.lru.Back())
+	}
+	metrics.CouponCacheEntries.Set(float64(c.lru.Len()))
+}
+
+func (c *CachingFileReader) removeLocked(elem *list.Element) {
+	c.lru.Remove(elem)
+	delete(c.entries, elem.Value.(*cacheEntry).promo)
+	metrics.CouponCacheEntries.Set(float64(c.lru.Len()))
+}
+
+func (c *CachingFileReader) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lru.Init()
+	c.entries = make(map[string]*list.Element)
+	c.generation++
+	c.invalidations.Add(1)
+	metrics.CouponCacheInvalidations.Inc()
+	metrics.CouponCacheEntries.Set(0)
+}
+
+func (c *CachingFileReader) Uncached() FileReader {
+	return c.next
+}
+
+func (c *CachingFileReader) CacheStats() CacheStats {
+	c.mu.Lock()
+	entries := c.lru.Len()
+	c.mu.Unlock()
+	return CacheStats{
+		Hits:          c.hits.Load(),
+		Misses:        c.misses.Load(),
+		Shared:        c.shared.Load(),
+		Entries:       entries,
+		Size:          c.opts.Size,
+		Invalidations: c.invalidations.Load(),
+	}
+}
+
+// cachingIndexAdmin is a caching reader over a reader with indexes, whose rebuilds purge the cache.
+type cachingIndexAdmin struct {
+	*CachingFileReader
+	admin IndexAdmin
+}
+
+func (c *cachingIndexAdmin) Indexes() []IndexInfo {
+	return c.admin.Indexes()
+}
+
+// Rebuild purges the cache once the rebuilt indexes serve, a failed rebuild keeps the indexes and the cache.
+func (c *cachingIndexAdmin) Rebuild(ctx context.Context, file string) ([]IndexInfo, error) {
+	infos, err := c.admin.Rebuild(ctx, file)
+	if err != nil {
+		return nil, err
+	}
+	c.Purge()
+	config.LoggerFrom(ctx).Info().Msg("Coupon lookup cache purged after the index rebuild")
+	return infos, nil
+}
@@ -0,0 +1,268 @@
+package reader
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeReader answers codes starting with V as valid, or what search returns when it is set, and
+// counts the lookups of every code.
+type fakeReader struct {
+	mu    sync.Mutex
+	calls map[string]int
+	// search is called with the number of the lookup of the promo, starting at 1
+	search func(call int, promo string) Explanation
+}
+
+func newFakeReader() *fakeReader {
+	return &fakeReader{calls: make(map[string]int)}
+}
+
+func (f *fakeReader) SearchPromo(ctx context.Context, promo string) (bool, error) {
+	explanation, err := f.ExplainPromo(ctx, promo)
+	return explanation.Valid, err
+}
+
+func (f *fakeReader) ExplainPromo(_ context.Context, promo string) (Explanation, error) {
+	f.mu.Lock()
+	f.calls[promo]++
+	call := f.calls[promo]
+	f.mu.Unlock()
+	if f.search != nil {
+		return f.search(call, promo), nil
+	}
+	explanation := newExplanation(promo)
+	explanation.Valid = strings.HasPrefix(promo, "V")
+	return explanation, nil
+}
+
+func (f *fakeReader) Status() Status {
+	return Status{State: StateReady}
+}
+
+func (f *fakeReader) callsOf(promo string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls[promo]
+}
+
+// fakeIndexReader is a fake reader with indexes, whose rebuilds always succeed.
+type fakeIndexReader struct {
+	*fakeReader
+}
+
+func (f fakeIndexReader) Indexes() []IndexInfo { return nil }
+
+func (f fakeIndexReader) Rebuild(context.Context, string) ([]IndexInfo, error) { return nil, nil }
+
+type testClock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+func (c *testClock) now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+func (c *testClock) advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.t = c.t.Add(d)
+}
+
+// newTestCache wraps next with a cache on a clock that only moves when advanced.
+func newTestCache(next FileReader, opts CacheOptions) (FileReader, *CachingFileReader, *testClock) {
+	clock := &testClock{t: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}
+	r := NewCachingFileReader(next, opts)
+	c, ok := r.(*CachingFileReader)
+	if !ok {
+		c = r.(*cachingIndexAdmin).CachingFileReader
+	}
+	c.now = clock.now
+	return r, c, clock
+}
+
+func explain(t *testing.T, r FileReader, promo string) Explanation {
+	t.Helper()
+	explanation, err := r.ExplainPromo(context.Background(), promo)
+	if err != nil {
+		t.Fatalf("ExplainPromo(%s): %v", promo, err)
+	}
+	return explanation
+}
+
+func TestCacheTTL(t *testing.T) {
+	type step struct {
+		advance   time.Duration
+		promo     string
+		wantCalls int // lookups of the promo the wrapped reader made so far
+	}
+	tests := []struct {
+		name  string
+		opts  CacheOptions
+		steps []step
+	}{
+		{"negative entries expire before positive ones", CacheOptions{Size: 10, PositiveTTL: time.Minute, NegativeTTL: 10 * time.Second}, []step{
+			{0, "VALID", 1},
+			{0, "INVALID", 1},
+			{10 * time.Second, "VALID", 1},
+			{0, "INVALID", 1},
+			{time.Second, "INVALID", 2},
+			{0, "VALID", 1},
+			{50 * time.Second, "VALID", 2},
+		}},
+		{"a zero negative TTL does not cache invalid codes", CacheOptions{Size: 10, PositiveTTL: time.Minute}, []step{
+			{0, "INVALID", 1},
+			{0, "INVALID", 2},
+			{0, "VALID", 1},
+			{0, "VALID", 1},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeReader()
+			r, _, clock := newTestCache(fake, tt.opts)
+			for i, s := range tt.steps {
+				clock.advance(s.advance)
+				if got := explain(t, r, s.promo); got.Valid != strings.HasPrefix(s.promo, "V") {
+					t.Fatalf("step %d: %s valid %t", i+1, s.promo, got.Valid)
+				}
+				if got := fake.callsOf(s.promo); got != s.wantCalls {
+					t.Fatalf("step %d: %s searched %d times, want %d", i+1, s.promo, got, s.wantCalls)
+				}
+			}
+		})
+	}
+}
+
+func TestCacheSharesConcurrentSearches(t *testing.T) {
+	const lookups = 10
+	entered, release := make(chan struct{}), make(chan struct{})
+	fake := newFakeReader()
+	fake.search = func(call int, promo string) Explanation {
+		if call == 1 {
+			close(entered)
+			<-release
+		}
+		explanation := newExplanation(promo)
+		explanation.Valid = true
+		return explanation
+	}
+	r, c, _ := newTestCache(fake, CacheOptions{Size: 10, PositiveTTL: time.Minute})
+
+	var wg sync.WaitGroup
+	for range lookups {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if explanation, err := r.ExplainPromo(context.Background(), "CODE"); err != nil || !explanation.Valid {
+				t.Errorf("CODE: valid %t, error %v", explanation.Valid, err)
+			}
+		}()
+	}
+	<-entered
+	// give the other lookups time to join the search before it ends
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if calls := fake.callsOf("CODE"); calls != 1 {
+		t.Fatalf("the wrapped reader searched %d times, want 1", calls)
+	}
+	stats := c.CacheStats()
+	if stats.Misses != 1 || stats.Shared+stats.Hits != lookups-1 {
+		t.Fatalf("misses %d, shared %d, hits %d, want 1 miss and %d shared or hits", stats.Misses, stats.Shared, stats.Hits, lookups-1)
+	}
+}
+
+func TestCachePurgeSeparatesSearches(t *testing.T) {
+	tests := []struct {
+		name  string
+		purge func(t *testing.T, r FileReader)
+	}{
+		{"purge", func(_ *testing.T, r FileReader) { r.(CacheAdmin).Purge() }},
+		{"rebuild", func(t *testing.T, r FileReader) {
+			if _, err := r.(IndexAdmin).Rebuild(context.Background(), ""); err != nil {
+				t.Fatal(err)
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the first search is of the files before the purge, where CODE was valid
+			entered, release := make(chan struct{}), make(chan struct{})
+			fake := newFakeReader()
+			fake.search = func(call int, promo string) Explanation {
+				explanation := newExplanation(promo)
+				if call == 1 {
+					close(entered)
+					<-release
+					explanation.Valid = true
+				}
+				return explanation
+			}
+			r, _, _ := newTestCache(fakeIndexReader{fake}, CacheOptions{Size: 10, PositiveTTL: time.Minute, NegativeTTL: time.Minute})
+
+			before := make(chan Explanation)
+			go func() {
+				explanation, _ := r.ExplainPromo(context.Background(), "CODE")
+				before <- explanation
+			}()
+			<-entered
+			tt.purge(t, r)
+
+			after := make(chan Explanation)
+			go func() {
+				explanation, _ := r.ExplainPromo(context.Background(), "CODE")
+				after <- explanation
+			}()
+			select {
+			case got := <-after:
+				if got.Valid {
+					t.Fatal("the lookup after the purge got the answer of the search before it")
+				}
+			case <-time.After(5 * time.Second):
+				close(release)
+				t.Fatal("the lookup after the purge joined the search before it")
+			}
+
+			close(release)
+			if got := <-before; !got.Valid {
+				t.Fatal("the lookup before the purge lost its answer")
+			}
+			if got := explain(t, r, "CODE"); got.Valid {
+				t.Fatal("the search before the purge filled the cache")
+			}
+			if calls := fake.callsOf("CODE"); calls != 2 {
+				t.Fatalf("the wrapped reader searched %d times, want 2", calls)
+			}
+		})
+	}
+}
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	fake := newFakeReader()
+	r, c, _ := newTestCache(fake, CacheOptions{Size: 2, PositiveTTL: time.Minute})
+
+	for _, promo := range []string{"VA", "VB", "VA", "VC"} {
+		explain(t, r, promo)
+	}
+	if entries := c.CacheStats().Entries; entries != 2 {
+		t.Fatalf("%d entries, want the size of 2", entries)
+	}
+	// VB was the least recently used when VC was added
+	for _, want := range []struct {
+		promo string
+		calls int
+	}{{"VA", 1}, {"VC", 1}, {"VB", 2}} {
+		explain(t, r, want.promo)
+		if calls := fake.callsOf(want.promo); calls != want.calls {
+			t.Fatalf("%s searched %d times, want %d", want.promo, calls, want.calls)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package reader
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/dekanayake/kart-challenge/backend-challenge/internal/coupon"
+)
+
+type FileError struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+// Explanation is the reasoning behind a coupon decision, file by file.
+type Explanation struct {
+	// Code is the code as searched for, after the policy normalized it.
+	Code  string `json:"code"`
+	Valid bool   `json:"valid"`
+	// Reason tells why an invalid code was rejected.
+	Reason string `json:"reason,omitempty"`
+	// Record is the coupon record of a valid code, with its discount and limits when the files have them.
+	Record *coupon.Record `json:"record,omitempty"`
+	// Matched lists the files the code was found in.
+	Matched []string `json:"matched"`
+	// SkippedByRange lists the files whose first and last key can not include the code.
+	SkippedByRange []string `json:"skippedByRange"`
+	// SearchedWithoutHit lists the files that could hold the code but do not.
+	SearchedWithoutHit []string `json:"searchedWithoutHit"`
+	// NotSearched lists the files left unsearched because the decision was made before they were reached.
+	NotSearched []string    `json:"notSearched"`
+	Errors      []FileError `json:"errors"`
+}
+
+func newExplanation(code string) Explanation {
+	return Explanation{
+		Code:               code,
+		Matched:            []string{},
+		SkippedByRange:     []string{},
+		SearchedWithoutHit: []string{},
+		NotSearched:        []string{},
+		Errors:             []FileError{},
+	}
+}
+
+// finish records the verdict of the policy and sorts the file lists, the searches complete in any order.
+// An undecided verdict can only be left after a search failed, it counts as invalid.
+func (e *Explanation) finish(verdict Verdict, reason string) {
+	e.Valid = verdict == Valid
+	e.Reason = reason
+	if verdict == Undecided {
+		e.Reason = "not every file could be searched"
+	}
+	slices.Sort(e.Matched)
+	slices.Sort(e.SkippedByRange)
+	slices.Sort(e.SearchedWithoutHit)
+	slices.Sort(e.NotSearched)
+	slices.SortFunc(e.Errors, func(a, b FileError) int {
+		return strings.Compare(a.Path, b.Path)
+	})
+}
+
+// pickRecord sets the record of a valid code from the matched files. The first matched file, by
+// path, with attributes wins, files listing the bare code only confirm it.
+func (e *Explanation) pickRecord(records map[string]coupon.Record) {
+	if !e.Valid {
+		return
+	}
+	for _, path := range e.Matched {
+		if record := records[path]; record.HasAttributes() {
+			e.Record = &record
+			return
+		}
+	}
+	e.Record = &coupon.Record{Code: e.Code}
+}
@@ -3,19 +3,35 @@ package reader
 import "fmt"
 
 const (
-	HDDReader = "hdd"
-	SSDReader = "ssd"
+	HDDReader         = "hdd"
+	SSDReader         = "ssd"
+	PrecomputedReader = "precomputed"
+	BTreeReader       = "btree"
 )
 
-func GetFileReader(readerType, rootPath string, chunkSize, searchWorkerPool int) (FileReader, error) {
+func GetFileReader(readerType string, opts Options) (FileReader, error) {
 	switch readerType {
 	case HDDReader:
-		hddReader, err := newHDDFileReader(rootPath, chunkSize, searchWorkerPool)
+		hddReader, err := newHDDFileReader(opts)
 		if err != nil {
 			return nil, fmt.Errorf("failed to initialize HDDFileReader: %w", err)
 		}
 		return hddReader, nil
 
+	case PrecomputedReader:
+		precomputedReader, err := newPrecomputedFileReader(opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize the precomputed reader: %w", err)
+		}
+		return precomputedReader, nil
+
+	case BTreeReader:
+		btreeReader, err := newBTreeFileReader(opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize the btree reader: %w", err)
+		}
+		return btreeReader, nil
+
 	// Since  SSD  can randoly access file content with less latency , a bainary search directly on file content  can be implemented on SSDReader
 	// With this appraoch , nned to find the last record count , then find the midle record , compare that promoCode , and move the read until mathing record is found in binary
 	// search on file.
@@ -0,0 +1,202 @@
+package reader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/dekanayake/kart-challenge/backend-challenge/internal/config"
+)
+
+func (r *HDDFileReader) Indexes() []IndexInfo {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	infos := make([]IndexInfo, 0, len(r.builds))
+	for _, build := range r.builds {
+		infos = append(infos, build.info())
+	}
+	return infos
+}
+
+func (b *fileBuild) info() IndexInfo {
+	info := IndexInfo{
+		Path:          b.path,
+		State:         b.state,
+		FileSizeBytes: b.sizeBytes,
+	}
+	if b.err != nil {
+		info.Error = b.err.Error()
+	}
+	if fi := b.index; fi != nil {
+		info.Format = "plain"
+		if fi.blockGzip {
+			info.Format = "block-gzip"
+		}
+		info.FirstKey = fi.firstKey
+		info.LastKey = fi.lastKey
+		info.IndexEntries = fi.entries()
+		info.StrideMode = fi.stride.mode
+		info.ChunkSize = fi.stride.lines
+		info.StrideBytes = fi.stride.bytes
+		if fi.tree != nil {
+			info.TreeHeight = fi.tree.Info().Height
+			info.TreePages = fi.tree.Info().Pages
+		}
+		info.BuiltAt = fi.builtAt
+		info.BuildDurationMs = fi.buildDuration.Milliseconds()
+		info.FileSizeBytes = fi.fileSize
+		info.FileModTime = fi.fileModTime
+	}
+	return info
+}
+
+// IndexEntry is one entry of a partial index, the first code of a chunk or block and its offset.
+type IndexEntry struct {
+	Key    string `json:"key"`
+	Offset int64  `json:"offset"`
+}
+
+// BuildIndex builds the partial index of one coupon file the way a reader with the stride options
+// and Strict of opts does, for offline tools. In auto mode the file has the whole memory budget.
+// The index is returned as the admin endpoints report it, with its entries.
+func BuildIndex(path string, opts Options) (IndexInfo, []IndexEntry, error) {
+	build := &fileBuild{path: path, state: StateBuilding}
+	info, err := os.Stat(path)
+	if err != nil {
+		build.state = StateFailed
+		build.err = err
+		return build.info(), nil, err
+	}
+	build.sizeBytes = info.Size()
+	st := newStrideConfig(opts).forFile(build.sizeBytes, build.sizeBytes)
+	fi, err := buildPartialIndex(path, st, opts.Strict, &build.bytesIndexed)
+	if err != nil {
+		build.state = StateFailed
+		build.err = err
+		return build.info(), nil, err
+	}
+	build.state = StateReady
+	build.index = fi
+
+	entries := make([]IndexEntry, len(fi.chunkKeys))
+	for i, key := range fi.chunkKeys {
+		entries[i] = IndexEntry{Key: key, Offset: fi.chunkOffsets[i]}
+	}
+	return build.info(), entries, nil
+}
+
+// Rebuild runs in the calling goroutine. Rebuilding every file picks up files added to or removed
+// from the folder, rebuilding one file needs it to be indexed already.
+func (r *HDDFileReader) Rebuild(ctx context.Context, file string) ([]IndexInfo, error) {
+	select {
+	case <-r.ready:
+	default:
+		return nil, ErrIndexBuilding
+	}
+	if !r.rebuildMu.TryLock() {
+		return nil, ErrRebuildInProgress
+	}
+	defer r.rebuildMu.Unlock()
+
+	var builds []*fileBuild
+	if file == "" {
+		found, err := r.findFiles()
+		if err != nil {
+			r.setRebuildErr(err)
+			return nil, err
+		}
+		builds = found
+	} else {
+		build, err := r.rebuildOf(file)
+		if err != nil {
+			return nil, err
+		}
+		builds = []*fileBuild{build}
+	}
+
+	start := time.Now()
+	config.LoggerFrom(ctx).Info().
+		Int("files", len(builds)).
+		Msg("Rebuilding partial indexes")
+
+	// the new builds are not in r.builds yet, the current indexes keep serving while they run
+	total := totalSize(builds)
+	if file != "" {
+		r.mu.RLock()
+		total = totalSize(replaceBuild(r.builds, builds[0]))
+		r.mu.RUnlock()
+	}
+	r.buildIndexes(builds, total)
+
+	var errs []error
+	for _, build := range builds {
+		if build.err != nil {
+			errs = append(errs, fmt.Errorf("index build failed for %s: %w", build.path, build.err))
+		}
+	}
+	if len(errs) > 0 {
+		err := errors.Join(errs...)
+		r.setRebuildErr(err)
+		return nil, err
+	}
+
+	r.mu.Lock()
+	r.rebuildErr = nil
+	if file == "" {
+		r.builds = builds
+	} else {
+		r.builds = replaceBuild(r.builds, builds[0])
+	}
+	r.publishLocked()
+	infos := make([]IndexInfo, 0, len(builds))
+	for _, build := range builds {
+		infos = append(infos, build.info())
+	}
+	r.mu.Unlock()
+
+	config.LoggerFrom(ctx).Info().
+		Int("files", len(builds)).
+		Dur("duration", time.Since(start)).
+		Msg("Partial indexes are rebuilt.")
+	return infos, nil
+}
+
+// setRebuildErr records the failure of a rebuild, the readiness probe fails until a rebuild succeeds.
+func (r *HDDFileReader) setRebuildErr(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.rebuildErr = err
+}
+
+// rebuildOf returns a new build for the indexed file matching file, by path or by file name.
+func (r *HDDFileReader) rebuildOf(file string) (*fileBuild, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, build := range r.builds {
+		if build.path == file || filepath.Base(build.path) == file {
+			return &fileBuild{
+				path:      build.path,
+				sizeBytes: build.sizeBytes,
+				state:     StateBuilding,
+			}, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnknownIndex, file)
+}
+
+// replaceBuild returns a copy of builds with the build of the same path replaced.
+func replaceBuild(builds []*fileBuild, build *fileBuild) []*fileBuild {
+	replaced := make([]*fileBuild, len(builds))
+	for i, b := range builds {
+		if b.path == build.path {
+			b = build
+		}
+		replaced[i] = b
+	}
+	return replaced
+}
@@ -5,30 +5,88 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/dekanayake/kart-challenge/backend-challenge/internal/blockgz"
+	"github.com/dekanayake/kart-challenge/backend-challenge/internal/btree"
 	"github.com/dekanayake/kart-challenge/backend-challenge/internal/config"
+	"github.com/dekanayake/kart-challenge/backend-challenge/internal/coupon"
+	"github.com/dekanayake/kart-challenge/backend-challenge/internal/metrics"
+	"github.com/dekanayake/kart-challenge/backend-challenge/internal/tracing"
+	"github.com/dekanayake/kart-challenge/backend-challenge/internal/verify"
+	"go.opentelemetry.io/otel/attribute"
 )
 
+// progressInterval is the number of lines between two updates of the index build progress.
+const progressInterval = 10000
+
 type fileIndex struct {
 	path         string
 	chunkKeys    []string
 	chunkOffsets []int64
 	firstKey     string
 	lastKey      string
-	chunkSize    int
+	stride       stride
+	// blockGzip files are indexed by block, chunkOffsets are the offsets of the compressed blocks.
+	blockGzip bool
+	// tree is the on-disk index of the btree reader, which has no chunkKeys in memory.
+	tree          *btree.Tree
+	fileSize      int64
+	fileModTime   time.Time
+	builtAt       time.Time
+	buildDuration time.Duration
+}
+
+// entries is the number of index entries, in memory or in the leaves of the on-disk index.
+func (fi *fileIndex) entries() int {
+	if fi.tree != nil {
+		return int(fi.tree.Info().Entries)
+	}
+	return len(fi.chunkOffsets)
+}
+
+// indexBuilder builds or loads the index of one coupon file.
+type indexBuilder func(path string, st stride, strict bool, bytesIndexed *atomic.Int64) (*fileIndex, error)
+
+// fileBuild tracks the background index build of one coupon file.
+type fileBuild struct {
+	path         string
+	sizeBytes    int64
+	bytesIndexed atomic.Int64
+	state        State
+	indexEntries int
+	index        *fileIndex
+	err          error
 }
 
 // HDDFileReader manages multiple indexed coupon files.
 type HDDFileReader struct {
-	rootPath    string
-	chunkSize   int
-	searchBatch int
-	fileIndexes []*fileIndex // sorted by firstKey
+	// findFiles lists the files to index, at startup and for a rebuild of every file
+	findFiles        func() ([]*fileBuild, error)
+	buildIndex       indexBuilder
+	strides          strideConfig
+	searchBatch      int
+	buildConcurrency int
+	strict           bool
+	pendingMode      string
+	waitTimeout      time.Duration
+	policy           Policy
+
+	rebuildMu   sync.Mutex // held while an admin rebuild runs, only one runs at a time
+	mu          sync.RWMutex
+	state       State
+	stateErr    error
+	rebuildErr  error // of the last admin rebuild, nil once a rebuild succeeds
+	builds      []*fileBuild
+	fileIndexes []*fileIndex  // sorted by firstKey
+	ready       chan struct{} // closed once the index build finished, successfully or not
 }
 
 // Coupon File reader for  HDD storage.
@@ -37,7 +95,8 @@ type HDDFileReader struct {
 // Following optimisations are implemented to make the search faster
 //
 //		(1) Sort the contents in the files in ascending order , its assume the files will be in sorting order before the application starts. sort script is available at utils/sort_file.gp
-//		(2) When the applcation starts reader  will read all the file contents
+//		    In strict mode (Options.Strict) the lines are verified while indexing and a file that is not sorted fails its build, otherwise a file that is not sorted gives wrong answers.
+//		(2) When the applcation starts reader  will read all the file contents, in the background and concurrently for the files, so the rest of the API is served while indexing
 //		(3) For each defined chunk size  reader will store the line , and offset of that line , this is called as partial index.
 //		(4) Also for each file  reader captures the first line and last line of the file
 //		(5) When SearchPromoCode function called , reader will filter files which assumes the content inside the file . To do this it check wheter promoCode >= firstline && promoCode <= lastLine
@@ -48,7 +107,67 @@ type HDDFileReader struct {
 //
 // . (8) coupon code search on a file operation will handle concurrently , in a worker pool . This is to avoid  creating go routines when large set of files are available to search.
 // .     Once the condition is matched context will be cancelled so any running coupon code search go routine will stop.
-func newHDDFileReader(rootPath string, chunkSize, searchWorkerPool int) (*HDDFileReader, error) {
+//
+// Searches made while the indexes are still building either wait for the build (PendingWait) or fail
+// straight away with ErrIndexBuilding (PendingReject).
+func newHDDFileReader(opts Options) (*HDDFileReader, error) {
+	return newIndexedFileReader(opts, func() ([]*fileBuild, error) {
+		return findCouponFiles(opts.RootPath)
+	}, buildPartialIndex)
+}
+
+// newIndexedFileReader starts the background index build of the files findFiles lists, with
+// buildIndex, and returns the reader searching them.
+func newIndexedFileReader(opts Options, findFiles func() ([]*fileBuild, error), buildIndex indexBuilder) (*HDDFileReader, error) {
+	builds, err := findFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	r := &HDDFileReader{
+		findFiles:        findFiles,
+		buildIndex:       buildIndex,
+		strides:          newStrideConfig(opts),
+		searchBatch:      opts.SearchWorkerPool,
+		buildConcurrency: max(opts.BuildConcurrency, 1),
+		strict:           opts.Strict,
+		pendingMode:      opts.PendingMode,
+		waitTimeout:      opts.PendingWaitTimeout,
+		policy:           opts.Policy,
+		state:            StateBuilding,
+		builds:           builds,
+		ready:            make(chan struct{}),
+	}
+	if r.policy == nil {
+		r.policy = DefaultPolicy()
+	}
+	metrics.CouponSearchWorkers.Set(float64(opts.SearchWorkerPool))
+
+	go func() {
+		defer close(r.ready)
+		start := time.Now()
+		config.Logger.Info().
+			Int("files", len(builds)).
+			Int("concurrency", r.buildConcurrency).
+			Msg("Building partial indexes in the background")
+
+		r.buildIndexes(builds, totalSize(builds))
+
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.publishLocked()
+		if r.state == StateReady {
+			config.Logger.Info().
+				Dur("duration", time.Since(start)).
+				Msg("Partial indexes are created.")
+		}
+	}()
+
+	return r, nil
+}
+
+// findCouponFiles lists the coupon files in rootPath, each with a build that still has to run.
+func findCouponFiles(rootPath string) ([]*fileBuild, error) {
 	files, err := filepath.Glob(filepath.Join(rootPath, "couponbase*"))
 	if err != nil {
 		return nil, err
@@ -56,112 +175,340 @@ func newHDDFileReader(rootPath string, chunkSize, searchWorkerPool int) (*HDDFil
 	if len(files) == 0 {
 		return nil, errors.New("no coupon files found")
 	}
+	return newBuilds(files)
+}
 
-	var indexes []*fileIndex
+// newBuilds returns a build that still has to run for each file.
+func newBuilds(files []string) ([]*fileBuild, error) {
+	builds := make([]*fileBuild, 0, len(files))
 	for _, path := range files {
-		fi, err := buildPartialIndex(path, chunkSize)
+		info, err := os.Stat(path)
 		if err != nil {
-			return nil, fmt.Errorf("index build failed for %s: %w", path, err)
+			return nil, err
 		}
-		indexes = append(indexes, fi)
+		builds = append(builds, &fileBuild{
+			path:      path,
+			sizeBytes: info.Size(),
+			state:     StateBuilding,
+		})
 	}
+	return builds, nil
+}
 
-	config.Logger.Info().
-		Msg("Partial indexes are created.")
-	for _, fileIndex := range indexes {
-		config.Logger.Info().
-			Str("path", fileIndex.path).
-			Int("index size", int(len(fileIndex.chunkOffsets))).
-			Msg("Partial index information")
+// totalSize is the size of the files of the builds, which share the index memory budget.
+func totalSize(builds []*fileBuild) int64 {
+	var total int64
+	for _, build := range builds {
+		total += build.sizeBytes
+	}
+	return total
+}
+
+// buildIndexes builds the partial index of every build, at most buildConcurrency files at a time.
+// totalSize is the size of all the files of the reader, for the strides of StrideAuto.
+func (r *HDDFileReader) buildIndexes(builds []*fileBuild, totalSize int64) {
+	sem := make(chan struct{}, r.buildConcurrency)
+	var wg sync.WaitGroup
+	for _, build := range builds {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			st := r.strides.forFile(build.sizeBytes, totalSize)
+			if st.capped {
+				config.Logger.Warn().
+					Str("path", build.path).
+					Int64("stride_bytes", st.bytes).
+					Int64("read_target_bytes", r.strides.readBytes).
+					Msg("The index memory budget makes lookups read more than the read target")
+			}
+			fi, err := r.buildIndex(build.path, st, r.strict, &build.bytesIndexed)
+
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			if err != nil {
+				build.state = StateFailed
+				build.err = err
+				config.Logger.Error().Err(err).Str("path", build.path).Msg("Partial index build failed")
+				return
+			}
+			build.state = StateReady
+			build.indexEntries = fi.entries()
+			build.index = fi
+
+			config.Logger.Info().
+				Str("path", fi.path).
+				Int("index size", fi.entries()).
+				Str("stride", fi.stride.String()).
+				Msg("Partial index information")
+		}()
+	}
+	wg.Wait()
+}
+
+// publishLocked makes the indexes of r.builds searchable. They are only published when every file
+// is built, a search never runs against a subset of the files. r.mu must be held.
+func (r *HDDFileReader) publishLocked() {
+	var errs []error
+	indexes := make([]*fileIndex, 0, len(r.builds))
+	for _, build := range r.builds {
+		if build.err != nil {
+			errs = append(errs, fmt.Errorf("index build failed for %s: %w", build.path, build.err))
+			continue
+		}
+		indexes = append(indexes, build.index)
+	}
+	if len(errs) > 0 {
+		r.state = StateFailed
+		r.stateErr = errors.Join(errs...)
+		return
 	}
 
 	// sort by firstKey lexicographically
 	sort.Slice(indexes, func(i, j int) bool {
 		return indexes[i].firstKey < indexes[j].firstKey
 	})
+	for _, fi := range indexes {
+		metrics.CouponIndexEntries.WithLabelValues(filepath.Base(fi.path)).Set(float64(fi.entries()))
+	}
+	// searches keep the slice they started with, so replacing it swaps the indexes atomically
+	r.fileIndexes = indexes
+	r.state = StateReady
+	r.stateErr = nil
+}
 
-	return &HDDFileReader{
-		rootPath:    rootPath,
-		chunkSize:   chunkSize,
-		searchBatch: searchWorkerPool,
-		fileIndexes: indexes,
-	}, nil
+// awaitIndexes returns the indexes to search, waiting for the build in PendingWait mode.
+func (r *HDDFileReader) awaitIndexes(ctx context.Context) ([]*fileIndex, error) {
+	select {
+	case <-r.ready:
+	default:
+		if r.pendingMode != PendingWait {
+			return nil, ErrIndexBuilding
+		}
+		config.LoggerFrom(ctx).Info().Msg("Coupon indexes are still building, waiting for them")
+		timer := time.NewTimer(r.waitTimeout)
+		defer timer.Stop()
+		select {
+		case <-r.ready:
+		case <-timer.C:
+			return nil, ErrIndexBuilding
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.state != StateReady {
+		return nil, fmt.Errorf("%w: %v", ErrReaderUnavailable, r.stateErr)
+	}
+	return r.fileIndexes, nil
+}
+
+// strictCheck verifies every line of a file indexed in strict mode. A line out of order fails the
+// build, the other issues do not change the lookups and are only counted and logged.
+type strictCheck struct {
+	path    string
+	checker *verify.Checker
+	counts  map[verify.Kind]int
+	first   *verify.Issue
+}
+
+// newStrictCheck returns nil when strict is false, the nil check accepts every line.
+func newStrictCheck(path string, strict bool) *strictCheck {
+	if !strict {
+		return nil
+	}
+	checker, _ := verify.NewChecker(verify.Options{})
+	return &strictCheck{path: path, checker: checker, counts: map[verify.Kind]int{}}
+}
+
+func (s *strictCheck) line(raw []byte, offset int64) error {
+	if s == nil {
+		return nil
+	}
+	for _, issue := range s.checker.Check(raw, offset) {
+		if issue.Kind == verify.OutOfOrder {
+			return fmt.Errorf("coupon file is not sorted, %s", issue)
+		}
+		s.counts[issue.Kind]++
+		if s.first == nil {
+			s.first = &issue
+		}
+	}
+	return nil
+}
+
+func (s *strictCheck) log() {
+	if s == nil || s.first == nil {
+		return
+	}
+	config.Logger.Warn().
+		Str("path", s.path).
+		Interface("issues", s.counts).
+		Str("first_issue", s.first.String()).
+		Msg("Coupon file is sorted but has issues")
 }
 
-// buildPartialIndex builds a simple index for one coupon file.
-func buildPartialIndex(path string, chunkSize int) (*fileIndex, error) {
+// buildPartialIndex builds a simple index for one coupon file. bytesIndexed is advanced while the
+// file is read, to report the build progress. In strict mode a file that is not sorted is an error.
+func buildPartialIndex(path string, st stride, strict bool, bytesIndexed *atomic.Int64) (*fileIndex, error) {
+	compressed, err := blockgz.IsBlockGzip(path)
+	if err != nil {
+		return nil, err
+	}
+	if compressed {
+		return buildBlockIndex(path, strict, bytesIndexed)
+	}
+
+	start := time.Now()
 	file, err := os.Open(path)
 	if err != nil {
 		return nil, err
 	}
 	defer file.Close()
 
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	// raw lines keep a CR, so the offsets count every byte of the file
 	scanner := bufio.NewScanner(file)
+	scanner.Split(verify.ScanRawLines)
+	check := newStrictCheck(path, strict)
 	var firstKey, lastKey string
 	var offsets []int64
 	var keys []string
-	var offset int64
+	var offset, lastEntry int64
 	lineCount := 0
 
 	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
+		raw := scanner.Bytes()
+		if err := check.line(raw, offset); err != nil {
+			return nil, err
+		}
+		lineOffset := offset
+		offset += int64(len(raw) + 1)
+
+		line := strings.TrimSpace(string(raw))
 		if line == "" {
 			continue
 		}
+		// records are indexed by their code
+		key := coupon.Key(line)
 		if firstKey == "" {
-			firstKey = line
+			firstKey = key
 		}
-		lastKey = line
-		if lineCount%chunkSize == 0 {
-			offsets = append(offsets, offset)
-			keys = append(keys, line)
+		lastKey = key
+		if st.due(lineCount, lineOffset, lastEntry, len(offsets)) {
+			lastEntry = lineOffset
+			offsets = append(offsets, lineOffset)
+			keys = append(keys, key)
 		}
-		offset += int64(len(line) + 1)
 		lineCount++
+		if lineCount%progressInterval == 0 {
+			bytesIndexed.Store(offset)
+		}
 	}
 	if err := scanner.Err(); err != nil {
 		return nil, err
 	}
+	bytesIndexed.Store(info.Size())
+	check.log()
 
 	return &fileIndex{
-		path:         path,
-		chunkKeys:    keys,
-		chunkOffsets: offsets,
-		firstKey:     firstKey,
-		lastKey:      lastKey,
-		chunkSize:    chunkSize,
+		path:          path,
+		chunkKeys:     keys,
+		chunkOffsets:  offsets,
+		firstKey:      firstKey,
+		lastKey:       lastKey,
+		stride:        st,
+		fileSize:      info.Size(),
+		fileModTime:   info.ModTime(),
+		builtAt:       time.Now(),
+		buildDuration: time.Since(start),
 	}, nil
 }
 
 func (r *HDDFileReader) SearchPromo(ctx context.Context, promo string) (bool, error) {
-	if len(r.fileIndexes) == 0 {
-		return false, errors.New("no indexed files")
+	explanation, err := r.ExplainPromo(ctx, promo)
+	return explanation.Valid, err
+}
+
+// ExplainPromo searches the files whose range includes the promo until the policy is decided,
+// the files still unsearched at that point are reported as NotSearched.
+func (r *HDDFileReader) ExplainPromo(ctx context.Context, promo string) (explanation Explanation, err error) {
+	ctx, span := tracing.StartSpan(ctx, "HDDFileReader.ExplainPromo")
+	defer func() {
+		span.SetAttributes(attribute.Bool("coupon.valid", explanation.Valid))
+		tracing.EndSpan(span, err)
+	}()
+
+	explanation = newExplanation(promo)
+	// malformed codes are rejected before the indexes are needed
+	promo, err = r.policy.Normalize(promo)
+	if err != nil {
+		explanation.finish(Invalid, err.Error())
+		return explanation, nil
+	}
+	explanation.Code = promo
+
+	fileIndexes, err := r.awaitIndexes(ctx)
+	if err != nil {
+		return explanation, err
 	}
+	if len(fileIndexes) == 0 {
+		return explanation, errors.New("no indexed files")
+	}
+
+	start := time.Now()
+	defer func() {
+		metrics.CouponSearchDuration.Observe(time.Since(start).Seconds())
+	}()
 
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
-	results := make(chan searchResult, len(r.fileIndexes))
-	jobs := make(chan *fileIndex, len(r.fileIndexes))
+	results := make(chan searchResult, len(fileIndexes))
+	jobs := make(chan *fileIndex, len(fileIndexes))
+	pending := make(map[string]bool, len(fileIndexes))
 
-	for _, fi := range r.fileIndexes {
+	for _, fi := range fileIndexes {
 		// skip files whose range cannot include the promo
 		if promo < fi.firstKey || promo > fi.lastKey {
-			config.Logger.Debug().
+			config.LoggerFrom(ctx).Debug().
 				Str("File path", fi.path).
 				Msg("Skipping searching in the file since Promo code is either small or larger than the first and last record of the file")
+			metrics.CouponSearchFiles.WithLabelValues("skipped").Inc()
+			explanation.SkippedByRange = append(explanation.SkippedByRange, fi.path)
 			continue
 		}
+		metrics.CouponSearchFiles.WithLabelValues("scanned").Inc()
+		pending[fi.path] = true
 		jobs <- fi
 	}
-	config.Logger.Debug().
+	span.SetAttributes(
+		attribute.Int("coupon.files.scanned", len(jobs)),
+		attribute.Int("coupon.files.skipped", len(fileIndexes)-len(jobs)))
+	config.LoggerFrom(ctx).Debug().
 		Int("jobs", len(jobs)).
 		Msg("Number of jobs")
 	close(jobs)
 
+	// the range filter alone can decide, e.g. when a required file can not hold the promo
+	verdict, reason := r.policy.Decide(nil, pendingPaths(pending))
+	if verdict != Undecided {
+		explanation.NotSearched = pendingPaths(pending)
+		explanation.finish(verdict, reason)
+		return explanation, nil
+	}
+
 	var wg sync.WaitGroup
 
-	config.Logger.Debug().
+	config.LoggerFrom(ctx).Debug().
 		Int("search batch", r.searchBatch).
 		Msg("Number of search batch")
 	for i := 0; i < r.searchBatch; i++ {
@@ -169,7 +516,7 @@ func (r *HDDFileReader) SearchPromo(ctx context.Context, promo string) (bool, er
 		go func(workerID int) {
 			defer wg.Done()
 			for fi := range jobs {
-				config.Logger.Debug().
+				config.LoggerFrom(ctx).Debug().
 					Int("worker_id", workerID).
 					Str("file_path", fi.path).
 					Msg("Worker starting to process file")
@@ -179,11 +526,13 @@ func (r *HDDFileReader) SearchPromo(ctx context.Context, promo string) (bool, er
 				default:
 				}
 
-				ok, err := searchPromoInFile(ctx, fi, promo)
+				metrics.CouponSearchWorkersBusy.Inc()
+				record, err := searchPromoInFile(ctx, fi, promo)
+				metrics.CouponSearchWorkersBusy.Dec()
 				select {
 				case <-ctx.Done():
 					return
-				case results <- searchResult{found: ok, path: fi.path, err: err}:
+				case results <- searchResult{found: record != nil, record: record, path: fi.path, err: err}:
 				}
 			}
 		}(i)
@@ -194,42 +543,66 @@ func (r *HDDFileReader) SearchPromo(ctx context.Context, promo string) (bool, er
 		close(results)
 	}()
 
-	foundCount := 0
 	var errs []error
+	records := make(map[string]coupon.Record)
 
 	for res := range results {
-		config.Logger.Debug().
+		config.LoggerFrom(ctx).Debug().
 			Str("file path", res.path).
 			Bool("found", res.found).
 			Msg("serach result details")
-		if res.err != nil {
-			config.Logger.Err(res.err).
+		delete(pending, res.path)
+		switch {
+		case res.err != nil:
+			config.LoggerFrom(ctx).Err(res.err).
 				Msg("Error occured while searching the promo code in file")
 			errs = append(errs, fmt.Errorf("%s: %w", res.path, res.err))
-			continue
+			explanation.Errors = append(explanation.Errors, FileError{Path: res.path, Error: res.err.Error()})
+		case res.found:
+			explanation.Matched = append(explanation.Matched, res.path)
+			records[res.path] = *res.record
+		default:
+			explanation.SearchedWithoutHit = append(explanation.SearchedWithoutHit, res.path)
 		}
-		if res.found {
-			foundCount++
-			if foundCount >= 2 {
-				cancel()
-				break
-			}
+
+		verdict, reason = r.policy.Decide(explanation.Matched, pendingPaths(pending))
+		if verdict != Undecided {
+			cancel()
+			break
 		}
 	}
+	explanation.NotSearched = pendingPaths(pending)
 
-	if len(errs) > 0 {
-		return foundCount >= 2, errors.Join(errs...)
+	explanation.finish(verdict, reason)
+	explanation.pickRecord(records)
+	return explanation, errors.Join(errs...)
+}
+
+func pendingPaths(pending map[string]bool) []string {
+	paths := make([]string, 0, len(pending))
+	for path := range pending {
+		paths = append(paths, path)
 	}
-	return foundCount >= 2, nil
+	return paths
 }
 
-// searchPromoInFile performs in-memory binary search for the target promo.
-func searchPromoInFile(ctx context.Context, fi *fileIndex, promo string) (bool, error) {
+// searchPromoInFile performs in-memory binary search for the target promo, and returns its
+// record, nil when the file does not hold the promo.
+func searchPromoInFile(ctx context.Context, fi *fileIndex, promo string) (record *coupon.Record, err error) {
+	ctx, span := tracing.StartSpan(ctx, "searchPromoInFile", attribute.String("coupon.file.path", fi.path))
+	defer func() {
+		span.SetAttributes(attribute.Bool("coupon.found", record != nil))
+		tracing.EndSpan(span, err)
+	}()
+
 	file, err := os.Open(fi.path)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 	defer file.Close()
+	if fi.tree != nil {
+		return searchPromoInTree(ctx, file, fi, promo)
+	}
 
 	idx := sort.Search(len(fi.chunkKeys), func(i int) bool {
 		return fi.chunkKeys[i] >= promo
@@ -238,49 +611,91 @@ func searchPromoInFile(ctx context.Context, fi *fileIndex, promo string) (bool,
 		idx--
 	}
 	if idx >= len(fi.chunkOffsets) {
-		return false, nil
+		return nil, nil
+	}
+	if fi.blockGzip {
+		return searchPromoInBlocks(ctx, file, fi.chunkOffsets[idx], promo)
 	}
 
-	_, err = file.Seek(fi.chunkOffsets[idx], 0)
+	// the code is in the two strides after the entry, the entry before the first key not below it
+	start, end := fi.chunkOffsets[idx], fi.fileSize
+	if idx+2 < len(fi.chunkOffsets) {
+		end = fi.chunkOffsets[idx+2]
+	}
+	_, err = file.Seek(start, io.SeekStart)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 
-	// Read one chunk fully into memory
-	scanner := bufio.NewScanner(file)
-	var lines []string
-	count := 0
+	// Read the two strides fully into memory
+	scanner := bufio.NewScanner(io.LimitReader(file, end-start))
+	var lines, keys []string
 	for scanner.Scan() {
 		select {
 		case <-ctx.Done():
-			return false, nil
+			return nil, nil
 		default:
 		}
 
 		line := strings.TrimSpace(scanner.Text())
-		if line != "" {
-			lines = append(lines, line)
-		}
-		count++
-		if count >= fi.chunkSize*2 {
-			break
+		if line == "" {
+			continue
 		}
+		lines = append(lines, line)
+		keys = append(keys, coupon.Key(line))
 	}
 	if err := scanner.Err(); err != nil {
-		return false, err
+		return nil, err
 	}
 
 	// binary search within the file
-	i := sort.SearchStrings(lines, promo)
-	if i < len(lines) && lines[i] == promo {
-		return true, nil
+	i := sort.SearchStrings(keys, promo)
+	if i < len(keys) && keys[i] == promo {
+		parsed, err := coupon.ParseRecord(lines[i])
+		if err != nil {
+			return nil, err
+		}
+		return &parsed, nil
 	}
 
-	return false, nil
+	return nil, nil
+}
+
+func (r *HDDFileReader) Status() Status {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	files := make([]FileStatus, 0, len(r.builds))
+	for _, build := range r.builds {
+		fs := FileStatus{
+			Path:         build.path,
+			State:        build.state,
+			IndexEntries: build.indexEntries,
+			SizeBytes:    build.sizeBytes,
+			BytesIndexed: min(build.bytesIndexed.Load(), build.sizeBytes),
+		}
+		if build.err != nil {
+			fs.Error = build.err.Error()
+		}
+		files = append(files, fs)
+	}
+
+	status := Status{
+		State: r.state,
+		Files: files,
+	}
+	if r.stateErr != nil {
+		status.Error = r.stateErr.Error()
+	}
+	if r.rebuildErr != nil {
+		status.RebuildError = r.rebuildErr.Error()
+	}
+	return status
 }
 
 type searchResult struct {
-	found bool
-	path  string
-	err   error
+	found  bool
+	record *coupon.Record
+	path   string
+	err    error
 }
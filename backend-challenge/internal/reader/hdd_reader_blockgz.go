@@ -0,0 +1,120 @@
+package reader
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/dekanayake/kart-challenge/backend-challenge/internal/blockgz"
+	"github.com/dekanayake/kart-challenge/backend-challenge/internal/coupon"
+	"github.com/dekanayake/kart-challenge/backend-challenge/internal/verify"
+)
+
+// buildBlockIndex indexes a block-gzip coupon file with one entry per block, the first code of the
+// block and the offset of the compressed block. The chunk size does not apply, the blocks are the chunks.
+// In strict mode the offsets of the issues are offsets in the decompressed content.
+func buildBlockIndex(path string, strict bool, bytesIndexed *atomic.Int64) (*fileIndex, error) {
+	start := time.Now()
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	fi := &fileIndex{
+		path:        path,
+		blockGzip:   true,
+		stride:      stride{mode: strideBlock},
+		fileSize:    info.Size(),
+		fileModTime: info.ModTime(),
+	}
+	check := newStrictCheck(path, strict)
+	var dataOffset int64
+	err = blockgz.Blocks(file, func(offset int64, block io.Reader) error {
+		bytesIndexed.Store(offset)
+		first := true
+		scanner := bufio.NewScanner(block)
+		scanner.Split(verify.ScanRawLines)
+		for scanner.Scan() {
+			raw := scanner.Bytes()
+			if err := check.line(raw, dataOffset); err != nil {
+				return err
+			}
+			dataOffset += int64(len(raw) + 1)
+			line := strings.TrimSpace(string(raw))
+			if line == "" {
+				continue
+			}
+			key := coupon.Key(line)
+			if first {
+				fi.chunkKeys = append(fi.chunkKeys, key)
+				fi.chunkOffsets = append(fi.chunkOffsets, offset)
+				first = false
+			}
+			if fi.firstKey == "" {
+				fi.firstKey = key
+			}
+			fi.lastKey = key
+		}
+		return scanner.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	bytesIndexed.Store(info.Size())
+	check.log()
+
+	fi.builtAt = time.Now()
+	fi.buildDuration = time.Since(start)
+	return fi, nil
+}
+
+// searchPromoInBlocks decompresses from the block at offset until it passes the promo, which
+// is one block, or two when the promo is the first code of the next block.
+func searchPromoInBlocks(ctx context.Context, file *os.File, offset int64, promo string) (*coupon.Record, error) {
+	r, err := blockgz.NewReaderAt(file, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return scanForPromo(ctx, r, promo)
+}
+
+// scanForPromo reads the sorted lines of r until it passes the promo, and returns its record, nil
+// when r does not hold the promo.
+func scanForPromo(ctx context.Context, r io.Reader, promo string) (*coupon.Record, error) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		select {
+		case <-ctx.Done():
+			return nil, nil
+		default:
+		}
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		key := coupon.Key(line)
+		if key > promo {
+			return nil, nil
+		}
+		if key == promo {
+			record, err := coupon.ParseRecord(line)
+			if err != nil {
+				return nil, err
+			}
+			return &record, nil
+		}
+	}
+	return nil, scanner.Err()
+}
@@ -0,0 +1,50 @@
+package reader
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	// ErrUnknownIndex is returned by Rebuild when no coupon file matches the requested one.
+	ErrUnknownIndex = errors.New("no coupon index for that file")
+	// ErrRebuildInProgress is returned by Rebuild while another rebuild is running.
+	ErrRebuildInProgress = errors.New("a coupon index rebuild is already running")
+)
+
+// IndexAdmin is implemented by readers whose per file indexes can be inspected and rebuilt at runtime.
+type IndexAdmin interface {
+	// Indexes describes the index of every coupon file, in file name order.
+	Indexes() []IndexInfo
+	// Rebuild builds the index of the named file, or of every coupon file in the folder when file is empty,
+	// and swaps it in once it is built. The current indexes keep serving when the build fails.
+	Rebuild(ctx context.Context, file string) ([]IndexInfo, error)
+}
+
+type IndexInfo struct {
+	Path string `json:"path"`
+	// Format is plain or block-gzip.
+	Format       string `json:"format,omitempty"`
+	State        State  `json:"state"`
+	Error        string `json:"error,omitempty"`
+	FirstKey     string `json:"firstKey"`
+	LastKey      string `json:"lastKey"`
+	IndexEntries int    `json:"indexEntries"`
+	// StrideMode is how the entries of the index were spaced: lines, bytes or auto for plain files
+	// and block for block-gzip files, which have an entry per block.
+	StrideMode string `json:"strideMode,omitempty"`
+	// ChunkSize is the number of lines per index entry in lines mode, zero otherwise.
+	ChunkSize int `json:"chunkSize"`
+	// StrideBytes is the distance in bytes between index entries in bytes and auto mode, the one
+	// picked for the file in auto mode.
+	StrideBytes int64 `json:"strideBytes,omitempty"`
+	// TreeHeight and TreePages describe the on-disk index of the btree reader, IndexEntries are the
+	// entries of its leaf pages.
+	TreeHeight      int       `json:"treeHeight,omitempty"`
+	TreePages       int64     `json:"treePages,omitempty"`
+	BuiltAt         time.Time `json:"builtAt"`
+	BuildDurationMs int64     `json:"buildDurationMs"`
+	FileSizeBytes   int64     `json:"fileSizeBytes"`
+	FileModTime     time.Time `json:"fileModTime"`
+}
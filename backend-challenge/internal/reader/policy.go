@@ -0,0 +1,110 @@
+package reader
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+type Verdict int
+
+const (
+	// Undecided means the files still to be searched can change the outcome.
+	Undecided Verdict = iota
+	Valid
+	Invalid
+)
+
+// Policy decides which coupon codes are valid. Readers ask it to decide after every searched
+// file, and stop searching as soon as the verdict is no longer Undecided.
+type Policy interface {
+	// Normalize returns the code to search the coupon files for, or why the code is malformed.
+	Normalize(code string) (string, error)
+	// Decide returns the verdict for the files the code was found in so far, while the pending
+	// files are still to be searched, with the reason for an Invalid verdict.
+	Decide(matched, pending []string) (Verdict, string)
+}
+
+// RulePolicy accepts codes of the configured length and charset that are found in at least
+// MinFileMatches files, and in every required file.
+type RulePolicy struct {
+	MinFileMatches int
+	// RequiredFiles are coupon file names, like couponbase1, that must contain the code.
+	RequiredFiles []string
+	MinLength     int
+	MaxLength     int
+	// Charset restricts the characters of a code to a regular expression character class, like A-Z0-9.
+	// Empty allows any character.
+	Charset string
+	// CaseSensitive false upper cases codes before the search, the coupon files must hold upper case codes.
+	CaseSensitive bool
+
+	charset *regexp.Regexp
+}
+
+// DefaultPolicy is the original rule: 8 to 10 characters, found in at least two files.
+func DefaultPolicy() *RulePolicy {
+	p, _ := NewRulePolicy(RulePolicy{
+		MinFileMatches: 2,
+		MinLength:      8,
+		MaxLength:      10,
+		CaseSensitive:  true,
+	})
+	return p
+}
+
+func NewRulePolicy(rules RulePolicy) (*RulePolicy, error) {
+	p := rules
+	if p.Charset != "" {
+		re, err := regexp.Compile("^[" + p.Charset + "]+$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid coupon charset %q: %w", p.Charset, err)
+		}
+		p.charset = re
+	}
+	return &p, nil
+}
+
+// Normalize folds the case first, so the length and charset rules apply to the code that is searched.
+func (p *RulePolicy) Normalize(code string) (string, error) {
+	if !p.CaseSensitive {
+		code = strings.ToUpper(code)
+	}
+	length := len(code)
+	if length < p.MinLength || length > p.MaxLength {
+		return "", fmt.Errorf("code must be %d to %d characters", p.MinLength, p.MaxLength)
+	}
+	if p.charset != nil && !p.charset.MatchString(code) {
+		return "", fmt.Errorf("code may only contain the characters [%s]", p.Charset)
+	}
+	return code, nil
+}
+
+func (p *RulePolicy) Decide(matched, pending []string) (Verdict, string) {
+	for _, required := range p.RequiredFiles {
+		if containsFile(matched, required) {
+			continue
+		}
+		if !containsFile(pending, required) {
+			return Invalid, fmt.Sprintf("required file %s does not contain the code", required)
+		}
+		return Undecided, ""
+	}
+
+	if len(matched) >= p.MinFileMatches {
+		return Valid, ""
+	}
+	if len(matched)+len(pending) < p.MinFileMatches {
+		return Invalid, fmt.Sprintf("found in %d files, %d needed", len(matched), p.MinFileMatches)
+	}
+	return Undecided, ""
+}
+
+// containsFile reports whether one of the paths is the named coupon file.
+func containsFile(paths []string, name string) bool {
+	return slices.ContainsFunc(paths, func(path string) bool {
+		return filepath.Base(path) == name
+	})
+}
@@ -0,0 +1,49 @@
+package reader
+
+import (
+	"path/filepath"
+)
+
+// ValidCouponsFile is the default name of the valid coupons file in the coupon folder. It does not
+// match couponbase*, so the HDD reader does not pick it up.
+const ValidCouponsFile = "valid_coupons"
+
+// newPrecomputedFileReader serves lookups from one sorted file of the codes the policy accepts,
+// written offline by kartctl coupon precompute. A lookup is a single seek into that
+// file instead of a search of every coupon file, so the file has to be recomputed whenever the
+// coupon files or the file rules of the policy change.
+//
+// It is an HDD reader over the one file, with the same partial index, block-gzip support, strict
+// mode and admin rebuild. The policy still normalizes the codes, but being in the file is what makes
+// a code valid.
+func newPrecomputedFileReader(opts Options) (*HDDFileReader, error) {
+	path := opts.ValidCouponsPath
+	if path == "" {
+		path = filepath.Join(opts.RootPath, ValidCouponsFile)
+	}
+	policy := opts.Policy
+	if policy == nil {
+		policy = DefaultPolicy()
+	}
+	opts.Policy = precomputedPolicy{Policy: policy}
+
+	return newIndexedFileReader(opts, func() ([]*fileBuild, error) {
+		return newBuilds([]string{path})
+	}, buildPartialIndex)
+}
+
+// precomputedPolicy accepts the codes found in the valid coupons file, the file rules of the
+// wrapped policy were applied when the file was computed.
+type precomputedPolicy struct {
+	Policy
+}
+
+func (p precomputedPolicy) Decide(matched, pending []string) (Verdict, string) {
+	switch {
+	case len(matched) > 0:
+		return Valid, ""
+	case len(pending) == 0:
+		return Invalid, "not in the valid coupons file"
+	}
+	return Undecided, ""
+}
@@ -2,8 +2,86 @@ package reader
 
 import (
 	"context"
+	"errors"
+	"time"
+
+	"github.com/dekanayake/kart-challenge/backend-challenge/internal/config"
+)
+
+var (
+	// ErrReaderUnavailable is returned by SearchPromo when the coupon indexes can not serve lookups.
+	ErrReaderUnavailable = errors.New("coupon reader is not available")
+	// ErrIndexBuilding is returned by SearchPromo while the coupon indexes are still being built.
+	ErrIndexBuilding = errors.New("coupon indexes are still building")
+)
+
+const (
+	// PendingReject fails searches made while the indexes are building with ErrIndexBuilding.
+	PendingReject = "reject"
+	// PendingWait holds searches made while the indexes are building until the build finished.
+	PendingWait = "wait"
 )
 
+// Options configures a FileReader.
+type Options struct {
+	RootPath string
+	// ChunkSize is the number of lines per index entry in StrideLines mode.
+	ChunkSize int
+	// StrideMode spaces the index entries of plain files: StrideLines, StrideBytes or StrideAuto.
+	// Empty is StrideLines.
+	StrideMode string
+	// StrideBytes is the distance between index entries in StrideBytes mode.
+	StrideBytes int64
+	// IndexMemoryBytes is the memory the index entries of all the files may take in StrideAuto mode,
+	// LookupReadBytes the data a lookup should read at most from one file.
+	IndexMemoryBytes   int64
+	LookupReadBytes    int64
+	SearchWorkerPool   int
+	BuildConcurrency   int
+	PendingMode        string
+	PendingWaitTimeout time.Duration
+	// Strict verifies the coupon files while indexing them, a file that is not sorted fails its build.
+	Strict bool
+	// ValidCouponsPath is the file the precomputed reader serves, RootPath/valid_coupons when empty.
+	ValidCouponsPath string
+	// Policy decides which codes are valid, DefaultPolicy when nil.
+	Policy Policy
+}
+
+// ConfigOptions returns the options of the coupon configuration, with its rule policy.
+func ConfigOptions(cfg config.CouponConfig) (Options, error) {
+	policy, err := NewRulePolicy(RulePolicy{
+		MinFileMatches: cfg.Policy.MinFileMatches,
+		RequiredFiles:  cfg.Policy.RequiredFiles,
+		MinLength:      cfg.Policy.MinLength,
+		MaxLength:      cfg.Policy.MaxLength,
+		Charset:        cfg.Policy.Charset,
+		CaseSensitive:  cfg.Policy.CaseSensitive,
+	})
+	if err != nil {
+		return Options{}, err
+	}
+	return Options{
+		RootPath:           cfg.FolderPath,
+		ChunkSize:          cfg.PartialIndexChunkSize,
+		StrideMode:         cfg.PartialIndexStride,
+		StrideBytes:        int64(cfg.PartialIndexStrideBytes),
+		IndexMemoryBytes:   int64(cfg.PartialIndexMemoryBytes),
+		LookupReadBytes:    int64(cfg.PartialIndexReadBytes),
+		SearchWorkerPool:   cfg.SearchPoolSize,
+		BuildConcurrency:   cfg.IndexBuildConcurrency,
+		PendingMode:        cfg.IndexPendingMode,
+		PendingWaitTimeout: time.Duration(cfg.IndexPendingWaitSeconds) * time.Second,
+		Strict:             cfg.StrictVerify,
+		ValidCouponsPath:   cfg.ValidCouponsPath,
+		Policy:             policy,
+	}, nil
+}
+
 type FileReader interface {
 	SearchPromo(ctx context.Context, promo string) (bool, error)
+	// ExplainPromo makes the same decision as SearchPromo and reports which files led to it.
+	ExplainPromo(ctx context.Context, promo string) (Explanation, error)
+	// Status reports whether the reader can serve lookups, with the state of each coupon file.
+	Status() Status
 }
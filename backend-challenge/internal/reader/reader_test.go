@@ -0,0 +1,127 @@
+package reader_test
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/dekanayake/kart-challenge/backend-challenge/internal/bench"
+	"github.com/dekanayake/kart-challenge/backend-challenge/internal/blockgz"
+	"github.com/dekanayake/kart-challenge/backend-challenge/internal/btree"
+	"github.com/dekanayake/kart-challenge/backend-challenge/internal/dataset"
+	"github.com/dekanayake/kart-challenge/backend-challenge/internal/reader"
+)
+
+// benchmarkCodes is 3 files of about 2MB of codes each, sampled with 1000 codes of each kind.
+const benchmarkCodes = 200_000
+
+var (
+	benchmarkChunkSizes = []int{100, 1000, 10000}
+	benchmarkWorkers    = []int{1, 4}
+)
+
+func prepareDataset(b *testing.B, blockSize int) *bench.Dataset {
+	b.Helper()
+	opts := dataset.DefaultOptions()
+	opts.Codes, opts.Samples, opts.BlockSize = benchmarkCodes, 1000, blockSize
+	ds, err := bench.Prepare(b.TempDir(), opts)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return ds
+}
+
+// BenchmarkIndexBuild builds the indexes of every file, from starting the reader until it is ready.
+// The btree cases write the on-disk indexes first, as kartctl index btree does, and then load them.
+//
+//	go test ./internal/reader -run x -bench IndexBuild
+func BenchmarkIndexBuild(b *testing.B) {
+	for _, format := range []struct {
+		name      string
+		blockSize int
+	}{{"plain", 0}, {"block-gzip", blockgz.DefaultBlockSize}} {
+		ds := prepareDataset(b, format.blockSize)
+		for _, chunkSize := range benchmarkChunkSizes {
+			b.Run(fmt.Sprintf("%s/chunk=%d", format.name, chunkSize), func(b *testing.B) {
+				var entries int
+				for b.Loop() {
+					r, _, err := ds.NewReader(reader.HDDReader, chunkSize, 1, 1)
+					if err != nil {
+						b.Fatal(err)
+					}
+					entries = 0
+					for _, file := range r.Status().Files {
+						entries += file.IndexEntries
+					}
+				}
+				b.ReportMetric(float64(entries), "entries")
+			})
+		}
+		b.Run(format.name+"/btree", func(b *testing.B) {
+			var entries int
+			for b.Loop() {
+				for _, path := range ds.Manifest.Paths(ds.Dir) {
+					if _, err := btree.Build(path, btree.IndexPath(path), btree.DefaultOptions()); err != nil {
+						b.Fatal(err)
+					}
+				}
+				r, _, err := ds.NewReader(reader.BTreeReader, 0, 1, 1)
+				if err != nil {
+					b.Fatal(err)
+				}
+				entries = 0
+				for _, file := range r.Status().Files {
+					entries += file.IndexEntries
+				}
+			}
+			b.ReportMetric(float64(entries), "entries")
+		})
+	}
+}
+
+// BenchmarkLookup looks the sample codes of the manifest up in turn, with warm page caches, and
+// reports the latency percentiles next to the mean.
+//
+//	go test ./internal/reader -run x -bench Lookup -benchmem
+func BenchmarkLookup(b *testing.B) {
+	ds := prepareDataset(b, 0)
+	for _, readerType := range []string{reader.HDDReader, reader.PrecomputedReader, reader.BTreeReader} {
+		chunkSizes := benchmarkChunkSizes
+		if readerType == reader.BTreeReader {
+			// the btree indexes are built by bench.Prepare, the chunk size does not apply
+			chunkSizes = []int{0}
+		}
+		for _, chunkSize := range chunkSizes {
+			for _, workers := range benchmarkWorkers {
+				b.Run(fmt.Sprintf("%s/chunk=%d/workers=%d", readerType, chunkSize, workers), func(b *testing.B) {
+					r, _, err := ds.NewReader(readerType, chunkSize, workers, 1)
+					if err != nil {
+						b.Fatal(err)
+					}
+					ctx := context.Background()
+					var durations []time.Duration
+					b.ReportAllocs()
+					i := 0
+					for b.Loop() {
+						n := i % len(ds.Codes)
+						start := time.Now()
+						valid, err := r.SearchPromo(ctx, ds.Codes[n])
+						durations = append(durations, time.Since(start))
+						if err != nil {
+							b.Fatal(err)
+						}
+						if valid != ds.Expected[n] {
+							b.Fatalf("%s: got valid %t, the manifest says %t", ds.Codes[n], valid, ds.Expected[n])
+						}
+						i++
+					}
+					slices.Sort(durations)
+					b.ReportMetric(float64(durations[len(durations)/2].Nanoseconds()), "p50-ns")
+					b.ReportMetric(float64(durations[len(durations)*99/100].Nanoseconds()), "p99-ns")
+				})
+			}
+		}
+	}
+}
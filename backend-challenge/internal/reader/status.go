@@ -0,0 +1,57 @@
+package reader
+
+import (
+	"context"
+	"fmt"
+)
+
+type State string
+
+const (
+	StateBuilding State = "building"
+	StateReady    State = "ready"
+	StateFailed   State = "failed"
+)
+
+type FileStatus struct {
+	Path         string `json:"path"`
+	State        State  `json:"state"`
+	IndexEntries int    `json:"indexEntries"`
+	SizeBytes    int64  `json:"sizeBytes"`
+	BytesIndexed int64  `json:"bytesIndexed"`
+	Error        string `json:"error,omitempty"`
+}
+
+type Status struct {
+	State State  `json:"state"`
+	Error string `json:"error,omitempty"`
+	// RebuildError is why the last admin rebuild failed, the indexes from before it keep serving.
+	RebuildError string       `json:"rebuildError,omitempty"`
+	Files        []FileStatus `json:"files"`
+}
+
+// unavailableFileReader stands in for a reader that failed to initialise, so the service can keep
+// serving everything that does not need coupons instead of running with a nil reader.
+type unavailableFileReader struct {
+	err error
+}
+
+func NewUnavailableFileReader(err error) FileReader {
+	return &unavailableFileReader{err: err}
+}
+
+func (r *unavailableFileReader) SearchPromo(ctx context.Context, promo string) (bool, error) {
+	return false, fmt.Errorf("%w: %v", ErrReaderUnavailable, r.err)
+}
+
+func (r *unavailableFileReader) ExplainPromo(ctx context.Context, promo string) (Explanation, error) {
+	return newExplanation(promo), fmt.Errorf("%w: %v", ErrReaderUnavailable, r.err)
+}
+
+func (r *unavailableFileReader) Status() Status {
+	return Status{
+		State: StateFailed,
+		Error: r.err.Error(),
+		Files: []FileStatus{},
+	}
+}
@@ -0,0 +1,89 @@
+package reader
+
+import "fmt"
+
+const (
+	// StrideLines adds an index entry every ChunkSize lines, the same count for every file.
+	StrideLines = "lines"
+	// StrideBytes adds an index entry at the first line starting StrideBytes or more after the previous entry.
+	StrideBytes = "bytes"
+	// StrideAuto picks a byte stride per file from IndexMemoryBytes and LookupReadBytes.
+	StrideAuto = "auto"
+	// strideBlock is the stride of block-gzip files, an entry per block.
+	strideBlock = "block"
+)
+
+// indexEntryBytes estimates the memory of one index entry: the key string and its header, and the offset.
+const indexEntryBytes = 48
+
+// stride is how far apart the index entries of one file are, in lines or in bytes.
+type stride struct {
+	mode  string
+	lines int
+	bytes int64
+	// capped is set when the memory budget made an auto stride larger than the read target allows.
+	capped bool
+}
+
+func (s stride) String() string {
+	switch s.mode {
+	case StrideLines:
+		return fmt.Sprintf("every %d lines", s.lines)
+	case strideBlock:
+		return "every block"
+	}
+	return fmt.Sprintf("%s, every %d bytes", s.mode, s.bytes)
+}
+
+// due reports whether the line starting at offset, after lineCount indexed lines, gets an index
+// entry. last is the offset of the previous entry, entries the number of entries so far.
+func (s stride) due(lineCount int, offset, last int64, entries int) bool {
+	if s.lines > 0 {
+		return lineCount%s.lines == 0
+	}
+	return entries == 0 || offset-last >= s.bytes
+}
+
+// strideConfig picks the index stride of each plain file of a reader.
+type strideConfig struct {
+	mode        string
+	lines       int
+	bytes       int64
+	memoryBytes int64
+	readBytes   int64
+}
+
+func newStrideConfig(opts Options) strideConfig {
+	return strideConfig{
+		mode:        opts.StrideMode,
+		lines:       opts.ChunkSize,
+		bytes:       opts.StrideBytes,
+		memoryBytes: opts.IndexMemoryBytes,
+		readBytes:   opts.LookupReadBytes,
+	}
+}
+
+// forFile returns the stride of a file of size bytes. In auto mode the files share the memory
+// budget in proportion to their size, out of totalSize bytes. A lookup reads the two strides after
+// the entry before the code, so the stride is half the read target, unless the entries of the file
+// would then take more than its share of the memory.
+func (c strideConfig) forFile(size, totalSize int64) stride {
+	switch c.mode {
+	case StrideBytes:
+		return stride{mode: StrideBytes, bytes: max(c.bytes, 1)}
+	case StrideAuto:
+		s := stride{mode: StrideAuto, bytes: max(c.readBytes/2, 1)}
+		if c.memoryBytes <= 0 || totalSize <= 0 {
+			return s
+		}
+		share := max(float64(c.memoryBytes)*float64(size)/float64(totalSize), indexEntryBytes)
+		// the smallest stride whose entries fit in the share
+		if needed := int64(float64(size)*indexEntryBytes/share) + 1; needed > s.bytes {
+			s.bytes = needed
+			s.capped = c.readBytes > 0
+		}
+		return s
+	default:
+		return stride{mode: StrideLines, lines: max(c.lines, 1)}
+	}
+}
@@ -0,0 +1,128 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dekanayake/kart-challenge/backend-challenge/internal/config"
+)
+
+const cartFileExtension = ".json"
+
+// FileCartRepository keeps carts in memory and writes every change to one JSON file per cart,
+// so carts survive a restart of the service. The files are written and removed under the lock of
+// the in-memory repository, so the file always holds the last change and a deleted cart stays deleted.
+// Writes go to a temp file which is then renamed over the cart file, so a crash never leaves a half written cart.
+type FileCartRepository struct {
+	*InMemoryCartRepository
+	dir string
+}
+
+func newFileCartRepository(dir string, ttl time.Duration) (*FileCartRepository, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create cart store directory %s: %w", dir, err)
+	}
+
+	r := &FileCartRepository{
+		InMemoryCartRepository: newInMemoryCartRepository(ttl),
+		dir:                    dir,
+	}
+	r.store = r.write
+	r.remove = r.removeFile
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Ping checks the cart store directory is still there, carts can not be persisted without it.
+func (r *FileCartRepository) Ping(ctx context.Context) error {
+	info, err := os.Stat(r.dir)
+	if err != nil {
+		return fmt.Errorf("cart store directory %s is not accessible: %w", r.dir, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("cart store path %s is not a directory", r.dir)
+	}
+	return nil
+}
+
+func (r *FileCartRepository) load() error {
+	entries, err := os.ReadDir(r.dir)
+	if err != nil {
+		return fmt.Errorf("failed to read cart store directory %s: %w", r.dir, err)
+	}
+
+	now := time.Now()
+	loaded := 0
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), cartFileExtension) {
+			continue
+		}
+		path := filepath.Join(r.dir, entry.Name())
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read cart file %s: %w", path, err)
+		}
+		var cart Cart
+		if err := json.Unmarshal(data, &cart); err != nil {
+			config.Logger.Warn().Err(err).Str("path", path).Msg("Skipping unreadable cart file")
+			continue
+		}
+		if r.expired(cart, now) {
+			_ = os.Remove(path)
+			continue
+		}
+		r.carts[cart.ID] = cart
+		loaded++
+	}
+
+	config.Logger.Info().
+		Str("dir", r.dir).
+		Int("carts", loaded).
+		Msg("Carts loaded from file store")
+	return nil
+}
+
+func (r *FileCartRepository) write(cart Cart) error {
+	data, err := json.Marshal(cart)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(r.dir, "cart-*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to persist cart %s: %w", cart.ID, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to persist cart %s: %w", cart.ID, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to persist cart %s: %w", cart.ID, err)
+	}
+	if err := os.Rename(tmp.Name(), r.path(cart.ID)); err != nil {
+		return fmt.Errorf("failed to persist cart %s: %w", cart.ID, err)
+	}
+	return nil
+}
+
+func (r *FileCartRepository) removeFile(ctx context.Context, id string) {
+	if err := os.Remove(r.path(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		config.LoggerFrom(ctx).Warn().Err(err).Str("cart_id", id).Msg("Failed to remove cart file")
+	}
+}
+
+// path is only called with ids of carts known to the repository, which are generated by CreateCart,
+// so request input never ends up in a file path.
+func (r *FileCartRepository) path(id string) string {
+	return filepath.Join(r.dir, id+cartFileExtension)
+}
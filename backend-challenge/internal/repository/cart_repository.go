@@ -0,0 +1,226 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/dekanayake/kart-challenge/backend-challenge/internal/config"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrCartNotFound = errors.New("cart not found")
+	// ErrCartConflict is returned when the cart was saved by another request since it was read.
+	ErrCartConflict = errors.New("cart was changed by another request")
+	// ErrCartCheckedOut is returned when the checkout of the cart has started.
+	ErrCartCheckedOut = errors.New("cart is being checked out")
+)
+
+// cartSweepInterval is how often CreateCart drops the expired carts, so abandoned carts do not pile
+// up in memory without every create scanning all carts.
+const cartSweepInterval = time.Minute
+
+// CartRepository stores shopping carts. Carts that are not updated within the
+// inactivity TTL are treated as expired and are no longer returned.
+type CartRepository interface {
+	CreateCart(ctx context.Context) (*Cart, error)
+	GetCart(ctx context.Context, id string) (*Cart, error)
+	// SaveCart stores the cart as the next version of the version it was read at. It fails with
+	// ErrCartConflict when another save came first, and with ErrCartCheckedOut once the checkout started.
+	SaveCart(ctx context.Context, cart *Cart) (*Cart, error)
+	// MarkCheckedOut starts the checkout of the cart at the version it was read at, the cart can not
+	// be saved or checked out again until it is deleted or reopened.
+	MarkCheckedOut(ctx context.Context, cart *Cart) (*Cart, error)
+	// ReopenCart ends a checkout that did not create an order.
+	ReopenCart(ctx context.Context, id string) error
+	DeleteCart(ctx context.Context, id string) error
+	// Ping checks the repository can serve requests.
+	Ping(ctx context.Context) error
+}
+
+type InMemoryCartRepository struct {
+	mu        sync.Mutex
+	ttl       time.Duration
+	carts     map[string]Cart
+	lastSweep time.Time
+	// store is called with every created or saved cart before it is kept, and remove with the id of
+	// every deleted or expired cart. Both run under the lock, so a durable store sees the changes of a
+	// cart in the order they were made.
+	store  func(cart Cart) error
+	remove func(ctx context.Context, id string)
+}
+
+func newInMemoryCartRepository(ttl time.Duration) *InMemoryCartRepository {
+	return &InMemoryCartRepository{
+		ttl:   ttl,
+		carts: make(map[string]Cart),
+	}
+}
+
+func (r *InMemoryCartRepository) CreateCart(ctx context.Context) (*Cart, error) {
+	now := time.Now()
+	cart := Cart{
+		ID:        uuid.NewString(),
+		Items:     []CartItem{},
+		Version:   1,
+		CreatedAt: now,
+		UpdatedAt: now,
+		ExpiresAt: now.Add(r.ttl),
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sweepLocked(ctx, now)
+	if err := r.storeLocked(cart); err != nil {
+		return nil, err
+	}
+	r.carts[cart.ID] = cart
+
+	config.LoggerFrom(ctx).Debug().
+		Str("cart_id", cart.ID).
+		Time("expires_at", cart.ExpiresAt).
+		Msg("New cart created")
+
+	return copyCart(cart), nil
+}
+
+// GetCart returns nil without an error when the cart does not exist or has expired.
+func (r *InMemoryCartRepository) GetCart(ctx context.Context, id string) (*Cart, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cart, ok := r.carts[id]
+	if !ok {
+		return nil, nil
+	}
+	if r.expired(cart, time.Now()) {
+		r.dropLocked(ctx, id)
+		return nil, nil
+	}
+	return copyCart(cart), nil
+}
+
+func (r *InMemoryCartRepository) SaveCart(ctx context.Context, cart *Cart) (*Cart, error) {
+	return r.update(ctx, cart.ID, cart.Version, func(existing Cart) Cart {
+		saved := *copyCart(*cart)
+		saved.CreatedAt = existing.CreatedAt
+		return saved
+	})
+}
+
+func (r *InMemoryCartRepository) MarkCheckedOut(ctx context.Context, cart *Cart) (*Cart, error) {
+	return r.update(ctx, cart.ID, cart.Version, func(existing Cart) Cart {
+		existing.CheckedOut = true
+		return existing
+	})
+}
+
+func (r *InMemoryCartRepository) ReopenCart(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	existing, ok := r.carts[id]
+	if !ok {
+		return ErrCartNotFound
+	}
+	existing.CheckedOut = false
+	existing.Version++
+	if err := r.storeLocked(existing); err != nil {
+		return err
+	}
+	r.carts[id] = existing
+	return nil
+}
+
+// update replaces the cart read at version with the result of change, as its next version. A
+// cart being checked out is not changed.
+func (r *InMemoryCartRepository) update(ctx context.Context, id string, version int, change func(existing Cart) Cart) (*Cart, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	existing, ok := r.carts[id]
+	if !ok {
+		return nil, ErrCartNotFound
+	}
+	if r.expired(existing, now) {
+		r.dropLocked(ctx, id)
+		return nil, ErrCartNotFound
+	}
+	if existing.CheckedOut {
+		return nil, ErrCartCheckedOut
+	}
+	if existing.Version != version {
+		return nil, ErrCartConflict
+	}
+
+	saved := change(existing)
+	saved.Version = existing.Version + 1
+	saved.UpdatedAt = now
+	saved.ExpiresAt = now.Add(r.ttl)
+	if err := r.storeLocked(saved); err != nil {
+		return nil, err
+	}
+	r.carts[saved.ID] = saved
+
+	return copyCart(saved), nil
+}
+
+func (r *InMemoryCartRepository) DeleteCart(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.carts[id]; !ok {
+		return ErrCartNotFound
+	}
+	delete(r.carts, id)
+	if r.remove != nil {
+		r.remove(ctx, id)
+	}
+	return nil
+}
+
+func (r *InMemoryCartRepository) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (r *InMemoryCartRepository) expired(cart Cart, now time.Time) bool {
+	return now.After(cart.ExpiresAt)
+}
+
+func (r *InMemoryCartRepository) storeLocked(cart Cart) error {
+	if r.store == nil {
+		return nil
+	}
+	return r.store(cart)
+}
+
+// sweepLocked drops the expired carts, at most once every cartSweepInterval.
+func (r *InMemoryCartRepository) sweepLocked(ctx context.Context, now time.Time) {
+	if now.Sub(r.lastSweep) < cartSweepInterval {
+		return
+	}
+	r.lastSweep = now
+	for id, cart := range r.carts {
+		if r.expired(cart, now) {
+			r.dropLocked(ctx, id)
+		}
+	}
+}
+
+func (r *InMemoryCartRepository) dropLocked(ctx context.Context, id string) {
+	delete(r.carts, id)
+	if r.remove != nil {
+		r.remove(ctx, id)
+	}
+	config.LoggerFrom(ctx).Debug().Str("cart_id", id).Msg("Cart expired after inactivity")
+}
+
+func copyCart(cart Cart) *Cart {
+	items := make([]CartItem, len(cart.Items))
+	copy(items, cart.Items)
+	cart.Items = items
+	return &cart
+}
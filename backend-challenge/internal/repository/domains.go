@@ -1,6 +1,10 @@
 package repository
 
-import "time"
+import (
+	"time"
+
+	"github.com/dekanayake/kart-challenge/backend-challenge/internal/coupon"
+)
 
 type PaginatedResult[T any] struct {
 	Page  int `json:"page"`
@@ -35,3 +39,23 @@ type Order struct {
 	Items      []OrderItem `json:"items"`
 	CreatedAt  time.Time   `json:"createdAt"`
 }
+
+type CartItem struct {
+	ProductId string `json:"productId"`
+	Quantity  int    `json:"quantity"`
+}
+
+type Cart struct {
+	ID         string `json:"id"`
+	CouponCode string `json:"couponCode,omitempty"`
+	// CouponRecord is the record of the coupon, kept so pricing the cart needs no coupon lookup.
+	CouponRecord coupon.Record `json:"couponRecord,omitzero"`
+	Items        []CartItem    `json:"items"`
+	// Version counts the saves of the cart, a save of an older version is rejected.
+	Version int `json:"version"`
+	// CheckedOut is set while the cart is converted to an order, the cart can not be changed then.
+	CheckedOut bool      `json:"checkedOut,omitempty"`
+	CreatedAt  time.Time `json:"createdAt"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+}
@@ -1,10 +1,23 @@
 package repository
 
-import "sync"
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dekanayake/kart-challenge/backend-challenge/internal/config"
+)
+
+const (
+	MemoryStore = "memory"
+	FileStore   = "file"
+)
 
 type RepositoryFactory struct {
 	productRepo ProductRepository
 	orderRepo   OrderRepository
+	cartRepo    CartRepository
+	cartErr     error
 }
 
 var factory RepositoryFactory
@@ -12,18 +25,39 @@ var factory RepositoryFactory
 var (
 	productOnce sync.Once
 	orderOnce   sync.Once
+	cartOnce    sync.Once
 )
 
 func GetProductRepository() ProductRepository {
 	productOnce.Do(func() {
-		factory.productRepo = newInMemoryProductRepository()
+		factory.productRepo = tracedProductRepository{newInMemoryProductRepository()}
 	})
 	return factory.productRepo
 }
 
 func GetOrderRepository() OrderRepository {
 	orderOnce.Do(func() {
-		factory.orderRepo = newInMemoryOrderRepository()
+		factory.orderRepo = tracedOrderRepository{newInMemoryOrderRepository()}
 	})
 	return factory.orderRepo
 }
+
+func GetCartRepository() (CartRepository, error) {
+	cartOnce.Do(func() {
+		ttl := time.Duration(config.AppConfig.Repositories.Cart.InactivityTTLMinutes) * time.Minute
+		switch config.AppConfig.Repositories.Cart.Type {
+		case MemoryStore:
+			factory.cartRepo = tracedCartRepository{newInMemoryCartRepository(ttl)}
+		case FileStore:
+			repo, err := newFileCartRepository(config.AppConfig.Repositories.Cart.StorePath, ttl)
+			if err != nil {
+				factory.cartErr = fmt.Errorf("failed to initialize FileCartRepository: %w", err)
+				return
+			}
+			factory.cartRepo = tracedCartRepository{repo}
+		default:
+			factory.cartErr = fmt.Errorf("unsupported cart repository type: %s", config.AppConfig.Repositories.Cart.Type)
+		}
+	})
+	return factory.cartRepo, factory.cartErr
+}
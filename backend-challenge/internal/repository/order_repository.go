@@ -1,31 +1,62 @@
 package repository
 
 import (
+	"context"
+	"errors"
+	"sync"
 	"time"
 
 	"github.com/dekanayake/kart-challenge/backend-challenge/internal/config"
 	"github.com/google/uuid"
 )
 
+// ErrCouponUsedUp is returned by CreateOrder when the coupon already reached its maximum number of uses.
+var ErrCouponUsedUp = errors.New("coupon code has been used up")
+
 type OrderRepository interface {
-	CreateOrder(items []OrderItem, couponCode string) (*Order, error)
+	// CreateOrder stores the order. When couponMaxUses is above zero the order is only created
+	// while fewer orders than that used the coupon, otherwise ErrCouponUsedUp is returned.
+	CreateOrder(ctx context.Context, items []OrderItem, couponCode string, couponMaxUses int) (*Order, error)
+	// CouponUses returns the number of orders that used the coupon code.
+	CouponUses(ctx context.Context, couponCode string) (int, error)
+	// Ping checks the repository can serve requests.
+	Ping(ctx context.Context) error
 }
 
-type InMemoryOrderRepository struct{}
+// InMemoryOrderRepository logs the orders, and only keeps the number of uses of each coupon code.
+type InMemoryOrderRepository struct {
+	mu         sync.Mutex
+	couponUses map[string]int
+}
 
 func newInMemoryOrderRepository() *InMemoryOrderRepository {
-	return &InMemoryOrderRepository{}
+	return &InMemoryOrderRepository{
+		couponUses: make(map[string]int),
+	}
 }
 
-func (r *InMemoryOrderRepository) CreateOrder(items []OrderItem, couponCode string) (*Order, error) {
+func (r *InMemoryOrderRepository) CreateOrder(ctx context.Context, items []OrderItem, couponCode string, couponMaxUses int) (*Order, error) {
+	if couponCode != "" {
+		// counting the use under the lock keeps concurrent orders from going over the maximum
+		r.mu.Lock()
+		if couponMaxUses > 0 && r.couponUses[couponCode] >= couponMaxUses {
+			r.mu.Unlock()
+			return nil, ErrCouponUsedUp
+		}
+		r.couponUses[couponCode]++
+		r.mu.Unlock()
+	}
+
 	order := Order{
-		ID:        uuid.NewString(),
-		Items:     items,
-		CreatedAt: time.Now(),
+		ID:         uuid.NewString(),
+		CouponCode: couponCode,
+		Items:      items,
+		CreatedAt:  time.Now(),
 	}
 
-	config.Logger.Info().
+	config.LoggerFrom(ctx).Info().
 		Str("order_id", order.ID).
+		Str("coupon_code", couponCode).
 		Int("items_count", len(items)).
 		Interface("items", items).
 		Time("created_at", order.CreatedAt).
@@ -33,3 +64,13 @@ func (r *InMemoryOrderRepository) CreateOrder(items []OrderItem, couponCode stri
 
 	return &order, nil
 }
+
+func (r *InMemoryOrderRepository) CouponUses(ctx context.Context, couponCode string) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.couponUses[couponCode], nil
+}
+
+func (r *InMemoryOrderRepository) Ping(ctx context.Context) error {
+	return nil
+}
@@ -1,12 +1,18 @@
 package repository
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"math"
+	"strings"
 )
 
 type ProductRepository interface {
-	GetProductByID(id string) (*Product, error)
-	ListProducts(page, limit int) (PaginatedResult[Product], error)
+	GetProductByID(ctx context.Context, id string) (*Product, error)
+	ListProducts(ctx context.Context, page, limit int) (PaginatedResult[Product], error)
+	// Ping checks the repository can serve requests.
+	Ping(ctx context.Context) error
 }
 
 type InMemoryProductRepository struct {
@@ -92,7 +98,39 @@ func newInMemoryProductRepository() *InMemoryProductRepository {
 	}
 }
 
-func (r *InMemoryProductRepository) GetProductByID(id string) (*Product, error) {
+// ValidateProducts checks a product catalog. Every product needs a unique id, a name, a category and
+// a positive price in whole cents. Every problem found is returned, not just the first one.
+func ValidateProducts(products []Product) error {
+	var errs []error
+	seen := make(map[string]int, len(products))
+	for i, p := range products {
+		name := fmt.Sprintf("product %d", i+1)
+		if p.ID != "" {
+			name = fmt.Sprintf("product %q", p.ID)
+		}
+		if strings.TrimSpace(p.ID) == "" {
+			errs = append(errs, fmt.Errorf("%s: id is required", name))
+		} else if first, ok := seen[p.ID]; ok {
+			errs = append(errs, fmt.Errorf("%s: id is already used by product %d", name, first+1))
+		} else {
+			seen[p.ID] = i
+		}
+		if strings.TrimSpace(p.Name) == "" {
+			errs = append(errs, fmt.Errorf("%s: name is required", name))
+		}
+		if strings.TrimSpace(p.Category.Name) == "" {
+			errs = append(errs, fmt.Errorf("%s: category is required", name))
+		}
+		if p.Price.Price <= 0 {
+			errs = append(errs, fmt.Errorf("%s: price must be greater than 0, got %g", name, p.Price.Price))
+		} else if cents := p.Price.Price * 100; math.Abs(cents-math.Round(cents)) > 1e-6 {
+			errs = append(errs, fmt.Errorf("%s: price %g has fractions of a cent", name, p.Price.Price))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (r *InMemoryProductRepository) GetProductByID(ctx context.Context, id string) (*Product, error) {
 	for _, p := range r.products {
 		if p.ID == id {
 			return &p, nil
@@ -101,11 +139,15 @@ func (r *InMemoryProductRepository) GetProductByID(id string) (*Product, error)
 	return nil, nil
 }
 
+func (r *InMemoryProductRepository) Ping(ctx context.Context) error {
+	return nil
+}
+
 // TODO: In a DB  limit with offset will be sufficient for small number of products ex : 100k
 // but if its in millions will need to handle the pagination using cursor . i.e., return the last cursor of paginated records,
 // limit will do a full page scan for every request which can slow down when fetching for pages at tail
 // so subsequant pages can fetch from that cursor upto limit.
-func (r *InMemoryProductRepository) ListProducts(page, limit int) (PaginatedResult[Product], error) {
+func (r *InMemoryProductRepository) ListProducts(ctx context.Context, page, limit int) (PaginatedResult[Product], error) {
 	if page < 1 {
 		page = 1
 	}
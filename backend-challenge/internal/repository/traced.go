@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/dekanayake/kart-challenge/backend-challenge/internal/tracing"
+)
+
+// The traced repositories wrap a repository with a span around every call, and pass the context of
+// the span on so the spans the repository starts are its children. Ping is not traced, it is
+// called by the health checks.
+
+type tracedProductRepository struct {
+	repo ProductRepository
+}
+
+func (r tracedProductRepository) GetProductByID(ctx context.Context, id string) (product *Product, err error) {
+	ctx, span := tracing.StartSpan(ctx, "ProductRepository.GetProductByID", attribute.String("product.id", id))
+	defer func() { tracing.EndSpan(span, err) }()
+	return r.repo.GetProductByID(ctx, id)
+}
+
+func (r tracedProductRepository) ListProducts(ctx context.Context, page, limit int) (result PaginatedResult[Product], err error) {
+	ctx, span := tracing.StartSpan(ctx, "ProductRepository.ListProducts", attribute.Int("page", page), attribute.Int("limit", limit))
+	defer func() { tracing.EndSpan(span, err) }()
+	return r.repo.ListProducts(ctx, page, limit)
+}
+
+func (r tracedProductRepository) Ping(ctx context.Context) error {
+	return r.repo.Ping(ctx)
+}
+
+type tracedOrderRepository struct {
+	repo OrderRepository
+}
+
+func (r tracedOrderRepository) CreateOrder(ctx context.Context, items []OrderItem, couponCode string, couponMaxUses int) (order *Order, err error) {
+	ctx, span := tracing.StartSpan(ctx, "OrderRepository.CreateOrder", attribute.Int("order.items", len(items)))
+	defer func() { tracing.EndSpan(span, err) }()
+	return r.repo.CreateOrder(ctx, items, couponCode, couponMaxUses)
+}
+
+func (r tracedOrderRepository) CouponUses(ctx context.Context, couponCode string) (uses int, err error) {
+	ctx, span := tracing.StartSpan(ctx, "OrderRepository.CouponUses")
+	defer func() { tracing.EndSpan(span, err) }()
+	return r.repo.CouponUses(ctx, couponCode)
+}
+
+func (r tracedOrderRepository) Ping(ctx context.Context) error {
+	return r.repo.Ping(ctx)
+}
+
+type tracedCartRepository struct {
+	repo CartRepository
+}
+
+func (r tracedCartRepository) CreateCart(ctx context.Context) (cart *Cart, err error) {
+	ctx, span := tracing.StartSpan(ctx, "CartRepository.CreateCart")
+	defer func() { tracing.EndSpan(span, err) }()
+	return r.repo.CreateCart(ctx)
+}
+
+func (r tracedCartRepository) GetCart(ctx context.Context, id string) (cart *Cart, err error) {
+	ctx, span := tracing.StartSpan(ctx, "CartRepository.GetCart", attribute.String("cart.id", id))
+	defer func() { tracing.EndSpan(span, err) }()
+	return r.repo.GetCart(ctx, id)
+}
+
+func (r tracedCartRepository) SaveCart(ctx context.Context, cart *Cart) (saved *Cart, err error) {
+	ctx, span := tracing.StartSpan(ctx, "CartRepository.SaveCart", attribute.String("cart.id", cart.ID))
+	defer func() { tracing.EndSpan(span, err) }()
+	return r.repo.SaveCart(ctx, cart)
+}
+
+func (r tracedCartRepository) MarkCheckedOut(ctx context.Context, cart *Cart) (marked *Cart, err error) {
+	ctx, span := tracing.StartSpan(ctx, "CartRepository.MarkCheckedOut", attribute.String("cart.id", cart.ID))
+	defer func() { tracing.EndSpan(span, err) }()
+	return r.repo.MarkCheckedOut(ctx, cart)
+}
+
+func (r tracedCartRepository) ReopenCart(ctx context.Context, id string) (err error) {
+	ctx, span := tracing.StartSpan(ctx, "CartRepository.ReopenCart", attribute.String("cart.id", id))
+	defer func() { tracing.EndSpan(span, err) }()
+	return r.repo.ReopenCart(ctx, id)
+}
+
+func (r tracedCartRepository) DeleteCart(ctx context.Context, id string) (err error) {
+	ctx, span := tracing.StartSpan(ctx, "CartRepository.DeleteCart", attribute.String("cart.id", id))
+	defer func() { tracing.EndSpan(span, err) }()
+	return r.repo.DeleteCart(ctx, id)
+}
+
+func (r tracedCartRepository) Ping(ctx context.Context) error {
+	return r.repo.Ping(ctx)
+}
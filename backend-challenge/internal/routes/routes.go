@@ -1,27 +1,106 @@
 package routes
 
 import (
+	"time"
+
 	"github.com/dekanayake/kart-challenge/backend-challenge/internal"
+	"github.com/dekanayake/kart-challenge/backend-challenge/internal/config"
 	"github.com/dekanayake/kart-challenge/backend-challenge/internal/controllers"
 	"github.com/dekanayake/kart-challenge/backend-challenge/internal/middleware"
+	"github.com/dekanayake/kart-challenge/backend-challenge/internal/ratelimit"
+	"github.com/dekanayake/kart-challenge/backend-challenge/internal/tracing"
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 )
 
 func SetupRouter(server internal.Server) *gin.Engine {
 	r := gin.New()
+	// gin trusts X-Forwarded-For from every peer by default, which lets a caller pick its rate limit key
+	if err := r.SetTrustedProxies(trustedProxies()); err != nil {
+		config.Logger.Fatal().Err(err).Msg("Invalid trusted proxies")
+	}
+	r.Use(otelgin.Middleware(tracing.ServiceName, otelgin.WithGinFilter(func(c *gin.Context) bool {
+		return c.FullPath() != "/metrics"
+	})))
+	r.Use(middleware.RequestID())
 	r.Use(middleware.ZerologMiddleware())
+	if config.AppConfig.Metrics.Enabled {
+		r.Use(middleware.MetricsMiddleware())
+	}
 	r.Use(gin.Recovery())
 
+	if config.AppConfig.Metrics.Enabled {
+		r.GET("/metrics", gin.WrapH(promhttp.Handler()))
+	}
+
+	// order creation and coupon lookups have separate budgets, a client guessing coupon codes
+	// through quotes or carts is limited the same way as one guessing through orders
+	var orderLimit gin.HandlerFunc = func(c *gin.Context) { c.Next() }
+	var couponGuard *ratelimit.CouponGuard
+	if config.AppConfig.RateLimit.Enabled {
+		orderLimit = middleware.RateLimit("order", ratelimit.NewLimiter(config.AppConfig.RateLimit.Order.PerMinute, config.AppConfig.RateLimit.Order.Burst))
+		couponGuard = ratelimit.NewCouponGuard(
+			ratelimit.NewLimiter(config.AppConfig.RateLimit.Coupon.PerMinute, config.AppConfig.RateLimit.Coupon.Burst),
+			ratelimit.NewLockout(
+				config.AppConfig.RateLimit.Coupon.LockoutThreshold,
+				time.Duration(config.AppConfig.RateLimit.Coupon.LockoutBaseSeconds)*time.Second,
+				time.Duration(config.AppConfig.RateLimit.Coupon.LockoutMaxSeconds)*time.Second,
+			),
+		)
+	}
+
 	productController := controllers.NewProductController(*server.ProductRepo)
-	orderController := controllers.NewOrderController(*server.OrderRepo, *server.ProductRepo, *server.FileReader)
+	adminController := controllers.NewAdminController(*server.FileReader)
+	healthController := controllers.NewHealthController(*server.ProductRepo, *server.OrderRepo, *server.CartRepo, *server.FileReader)
+	orderController := controllers.NewOrderController(*server.OrderRepo, *server.ProductRepo, *server.FileReader, couponGuard)
+	cartController := controllers.NewCartController(*server.CartRepo, *server.ProductRepo, orderController)
 
 	api := r.Group("/api")
+	api.Use(middleware.RateLimitKeys(append([]string{config.AppConfig.Auth.AdminAPIKey}, config.AppConfig.RateLimit.APIKeys...)...))
 	{
-		api.GET("/health", controllers.HealthHandler)
+		api.GET("/health", healthController.Live)
+		api.GET("/health/live", healthController.Live)
+		api.GET("/health/ready", healthController.Ready)
 		api.GET("/product/:productId", productController.GetProductByID)
 		api.GET("/product", productController.ListProducts)
-		api.POST("/order", orderController.CreateOrder)
+		api.POST("/order", orderLimit, orderController.CreateOrder)
+		api.POST("/order/quote", orderController.QuoteOrder)
+
+		api.POST("/cart", cartController.CreateCart)
+		api.GET("/cart/:cartId", cartController.GetCart)
+		api.POST("/cart/:cartId/items", cartController.AddItem)
+		api.PUT("/cart/:cartId/items/:productId", cartController.SetItemQuantity)
+		api.DELETE("/cart/:cartId/items/:productId", cartController.RemoveItem)
+		api.PUT("/cart/:cartId/coupon", cartController.ApplyCoupon)
+		api.DELETE("/cart/:cartId/coupon", cartController.RemoveCoupon)
+		api.POST("/cart/:cartId/checkout", orderLimit, cartController.Checkout)
+	}
+
+	// admin endpoints are only served when an admin api key is configured
+	if config.AppConfig.Auth.AdminAPIKey != "" {
+		admin := api.Group("/admin")
+		admin.Use(middleware.AdminAuth(config.AppConfig.Auth.AdminAPIKey))
+		{
+			admin.GET("/log-level", adminController.GetLogLevel)
+			admin.PUT("/log-level", adminController.SetLogLevel)
+			admin.GET("/coupon-indexes", adminController.ListCouponIndexes)
+			admin.POST("/coupon-indexes/rebuild", adminController.RebuildCouponIndexes)
+			admin.GET("/coupon-indexes/lookup/:code", adminController.ExplainCoupon)
+			admin.GET("/coupon-cache", adminController.GetCouponCache)
+			admin.DELETE("/coupon-cache", adminController.PurgeCouponCache)
+		}
+	} else {
+		config.Logger.Warn().Msg("ADMIN_API_KEY is not set, admin endpoints are disabled")
 	}
 
 	return r
 }
+
+// trustedProxies returns the configured proxies, nil when there are none so gin trusts no peer.
+func trustedProxies() []string {
+	if len(config.AppConfig.Server.TrustedProxies) == 0 {
+		return nil
+	}
+	return config.AppConfig.Server.TrustedProxies
+}
@@ -8,5 +8,6 @@ import (
 type Server struct {
 	ProductRepo *repository.ProductRepository
 	OrderRepo   *repository.OrderRepository
+	CartRepo    *repository.CartRepository
 	FileReader  *reader.FileReader
 }
@@ -0,0 +1,120 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/dekanayake/kart-challenge/backend-challenge/internal/config"
+)
+
+const (
+	ServiceName = "kart-service"
+	tracerName  = "github.com/dekanayake/kart-challenge/backend-challenge"
+)
+
+const (
+	NoneExporter   = "none"
+	StdoutExporter = "stdout"
+	FileExporter   = "file"
+	OTLPExporter   = "otlp"
+)
+
+// Init installs the global tracer provider for the configured exporter and the W3C trace context
+// propagator. The OTLP exporter is configured through the standard OTEL_EXPORTER_OTLP_* variables.
+// The returned function flushes pending spans and must be called on shutdown.
+func Init(ctx context.Context) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	var exporter sdktrace.SpanExporter
+	var file io.Closer
+	switch config.AppConfig.Tracing.Exporter {
+	case NoneExporter:
+		return func(context.Context) error { return nil }, nil
+	case StdoutExporter:
+		exp, err := stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+		if err != nil {
+			return nil, err
+		}
+		exporter = exp
+	case FileExporter:
+		f, err := os.OpenFile(config.AppConfig.Tracing.FilePath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open trace file %s: %w", config.AppConfig.Tracing.FilePath, err)
+		}
+		exp, err := stdouttrace.New(stdouttrace.WithWriter(f))
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		exporter = exp
+		file = f
+	case OTLPExporter:
+		exp, err := otlptracehttp.New(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
+		}
+		exporter = exp
+	default:
+		return nil, fmt.Errorf("unsupported tracing exporter: %s", config.AppConfig.Tracing.Exporter)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(ServiceName),
+		attribute.String("deployment.environment", config.AppConfig.Server.Environment),
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(config.AppConfig.Tracing.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+
+	config.Logger.Info().
+		Str("exporter", config.AppConfig.Tracing.Exporter).
+		Float64("sample_ratio", config.AppConfig.Tracing.SampleRatio).
+		Msg("Tracing initialised")
+
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if file != nil {
+			file.Close()
+		}
+		return err
+	}, nil
+}
+
+// StartSpan starts a child span of the span in ctx. Without Init the global no-op provider is used,
+// so callers never need to check whether tracing is enabled.
+func StartSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// EndSpan records the error, if any, on the span and ends it.
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,180 @@
+// Package validset computes the valid coupon codes of sorted coupon files offline. The files are
+// merged with a streaming k-way merge, like the merge of the external sort, so every code is seen
+// once with all the files that hold it and memory does not grow with the size of the files.
+package validset
+
+import (
+	"bufio"
+	"container/heap"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/dekanayake/kart-challenge/backend-challenge/internal/blockgz"
+	"github.com/dekanayake/kart-challenge/backend-challenge/internal/coupon"
+	"github.com/dekanayake/kart-challenge/backend-challenge/internal/reader"
+)
+
+// Stats account for one Build.
+type Stats struct {
+	// Files is the number of lines read from each file, by file name.
+	Files map[string]int `json:"files"`
+	// Codes is the number of distinct codes across the files.
+	Codes int `json:"codes"`
+	Valid int `json:"valid"`
+}
+
+type cursor struct {
+	path    string
+	file    *os.File
+	closer  io.Closer
+	scanner *bufio.Scanner
+	line    string
+	key     string
+	lineNo  int
+}
+
+// next moves to the next non blank line, it returns false at the end of the file.
+func (c *cursor) next() (bool, error) {
+	for c.scanner.Scan() {
+		c.lineNo++
+		line := strings.TrimSpace(c.scanner.Text())
+		if line == "" {
+			continue
+		}
+		key := coupon.Key(line)
+		if key < c.key {
+			return false, fmt.Errorf("%s is not sorted, %q on line %d sorts before %q", c.path, key, c.lineNo, c.key)
+		}
+		c.line, c.key = line, key
+		return true, nil
+	}
+	return false, c.scanner.Err()
+}
+
+func (c *cursor) close() {
+	if c.closer != nil {
+		c.closer.Close()
+	}
+	c.file.Close()
+}
+
+func open(path string) (*cursor, error) {
+	compressed, err := blockgz.IsBlockGzip(path)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	c := &cursor{path: path, file: f}
+	var r io.Reader = f
+	if compressed {
+		gz, err := blockgz.NewReader(f)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		c.closer = gz
+		r = gz
+	}
+	c.scanner = bufio.NewScanner(r)
+	return c, nil
+}
+
+type cursorHeap []*cursor
+
+func (h cursorHeap) Len() int { return len(h) }
+func (h cursorHeap) Less(i, j int) bool {
+	if h[i].key != h[j].key {
+		return h[i].key < h[j].key
+	}
+	// files holding the same code come out in path order, so the record kept does not depend on timing
+	return h[i].path < h[j].path
+}
+func (h cursorHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *cursorHeap) Push(x any)   { *h = append(*h, x.(*cursor)) }
+func (h *cursorHeap) Pop() any {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
+
+// Build writes the codes of the sorted coupon files that policy decides are valid to w, in order.
+// Only the matched files decide, every file has been read by then. A valid code keeps the first
+// record line with attributes of the files holding it, in path order, like a lookup does.
+func Build(paths []string, w io.Writer, policy reader.Policy) (Stats, error) {
+	stats := Stats{Files: make(map[string]int, len(paths))}
+	paths = slices.Sorted(slices.Values(paths))
+
+	h := &cursorHeap{}
+	defer func() {
+		for _, c := range *h {
+			c.close()
+		}
+	}()
+	for _, path := range paths {
+		c, err := open(path)
+		if err != nil {
+			return stats, err
+		}
+		ok, err := c.next()
+		if err != nil || !ok {
+			c.close()
+			if err != nil {
+				return stats, err
+			}
+			continue
+		}
+		stats.Files[filepath.Base(path)]++
+		heap.Push(h, c)
+	}
+
+	out := bufio.NewWriter(w)
+	var matched []string
+	for h.Len() > 0 {
+		key := (*h)[0].key
+		line := ""
+		matched = matched[:0]
+		for h.Len() > 0 && (*h)[0].key == key {
+			c := heap.Pop(h).(*cursor)
+			if len(matched) == 0 || matched[len(matched)-1] != c.path {
+				matched = append(matched, c.path)
+			}
+			if line == "" && c.line != key {
+				line = c.line
+			}
+
+			ok, err := c.next()
+			if err != nil {
+				c.close()
+				return stats, err
+			}
+			if !ok {
+				c.close()
+				continue
+			}
+			stats.Files[filepath.Base(c.path)]++
+			heap.Push(h, c)
+		}
+
+		stats.Codes++
+		if verdict, _ := policy.Decide(matched, nil); verdict != reader.Valid {
+			continue
+		}
+		if line == "" {
+			line = key
+		}
+		if _, err := out.WriteString(line + "\n"); err != nil {
+			return stats, err
+		}
+		stats.Valid++
+	}
+	return stats, out.Flush()
+}
@@ -0,0 +1,223 @@
+// Package verify checks that coupon files are sorted and well formed, which the HDD file reader
+// assumes and can not tell from a lookup. A file that is not sorted gives wrong answers silently.
+package verify
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/dekanayake/kart-challenge/backend-challenge/internal/blockgz"
+	"github.com/dekanayake/kart-challenge/backend-challenge/internal/coupon"
+)
+
+type Kind string
+
+const (
+	// OutOfOrder is a code that sorts before the code on the line before it.
+	OutOfOrder Kind = "out_of_order"
+	// Duplicate is a code equal to the code on the line before it.
+	Duplicate        Kind = "duplicate"
+	Blank            Kind = "blank"
+	CRLF             Kind = "crlf"
+	InvalidCharacter Kind = "invalid_character"
+)
+
+// Kinds lists every kind of issue, in the order they are reported.
+var Kinds = []Kind{OutOfOrder, Duplicate, Blank, CRLF, InvalidCharacter}
+
+// Issue is one problem found on a line. Line numbers start at 1 and count every line, blank ones
+// included. Offset is the byte offset of the problem, in the decompressed content for block-gzip files.
+type Issue struct {
+	Kind   Kind   `json:"kind"`
+	Line   int    `json:"line"`
+	Offset int64  `json:"offset"`
+	Detail string `json:"detail"`
+}
+
+func (i Issue) String() string {
+	return fmt.Sprintf("line %d (byte offset %d): %s: %s", i.Line, i.Offset, i.Kind, i.Detail)
+}
+
+type Options struct {
+	// Charset is a regular expression character class the codes must match, like A-Z0-9. Empty
+	// allows any character but control characters and invalid UTF-8.
+	Charset string
+	// MaxIssues bounds the issues kept in a report, every issue is still counted. 0 keeps them all.
+	MaxIssues int
+}
+
+// Checker checks the lines of one file in order.
+type Checker struct {
+	class   string
+	charset *regexp.Regexp
+	line    int
+	prevKey string
+	hasPrev bool
+}
+
+func NewChecker(opts Options) (*Checker, error) {
+	c := &Checker{class: opts.Charset}
+	if opts.Charset != "" {
+		charset, err := regexp.Compile("^[" + opts.Charset + "]+$")
+		if err != nil {
+			return nil, fmt.Errorf("charset must be a regular expression character class: %w", err)
+		}
+		c.charset = charset
+	}
+	return c, nil
+}
+
+// Check checks the next line of the file, raw as read with ScanRawLines, which starts at offset.
+// It returns nil when the line has no issues.
+func (c *Checker) Check(raw []byte, offset int64) []Issue {
+	c.line++
+	var issues []Issue
+	add := func(kind Kind, at int64, format string, args ...any) {
+		issues = append(issues, Issue{Kind: kind, Line: c.line, Offset: at, Detail: fmt.Sprintf(format, args...)})
+	}
+
+	if n := len(raw); n > 0 && raw[n-1] == '\r' {
+		add(CRLF, offset+int64(n-1), "line ends with CRLF")
+		raw = raw[:n-1]
+	}
+	if len(bytes.TrimSpace(raw)) == 0 {
+		add(Blank, offset, "blank line")
+		return issues
+	}
+
+	if i, r := invalidRune(raw); i >= 0 {
+		add(InvalidCharacter, offset+int64(i), "invalid character %q", r)
+	}
+	line := strings.TrimSpace(string(raw))
+	key := coupon.Key(line)
+	if c.charset != nil && !c.charset.MatchString(key) {
+		add(InvalidCharacter, offset+int64(bytes.Index(raw, []byte(key))), "code %q has characters outside [%s]", key, c.class)
+	}
+
+	if c.hasPrev {
+		switch {
+		case key < c.prevKey:
+			add(OutOfOrder, offset, "%q sorts before %q on the line before", key, c.prevKey)
+		case key == c.prevKey:
+			add(Duplicate, offset, "%q repeats the line before", key)
+		}
+	}
+	c.prevKey = key
+	c.hasPrev = true
+	return issues
+}
+
+// invalidRune returns the index of the first control character or invalid UTF-8 in raw, tabs
+// separate record fields and are allowed. It returns -1 when there is none.
+func invalidRune(raw []byte) (int, rune) {
+	for i := 0; i < len(raw); {
+		r, size := utf8.DecodeRune(raw[i:])
+		if r == utf8.RuneError && size <= 1 {
+			return i, rune(raw[i])
+		}
+		if r != '\t' && unicode.IsControl(r) {
+			return i, r
+		}
+		i += size
+	}
+	return -1, 0
+}
+
+// ScanRawLines is a bufio.SplitFunc like bufio.ScanLines that keeps a trailing \r, so the length
+// of every token plus its newline is the number of bytes it takes in the file.
+func ScanRawLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// Report is the result of verifying one file.
+type Report struct {
+	Path       string `json:"path"`
+	Compressed bool   `json:"compressed"`
+	Lines      int    `json:"lines"`
+	// Bytes is the size of the content, decompressed for block-gzip files.
+	Bytes  int64        `json:"bytes"`
+	Sorted bool         `json:"sorted"`
+	Counts map[Kind]int `json:"counts"`
+	Issues []Issue      `json:"issues"`
+	// Truncated is set when there were more issues than Options.MaxIssues.
+	Truncated bool `json:"truncated"`
+}
+
+// OK reports whether the file has no issues at all.
+func (r *Report) OK() bool {
+	return len(r.Counts) == 0
+}
+
+// File verifies a plain or block-gzip coupon file.
+func File(path string, opts Options) (*Report, error) {
+	checker, err := NewChecker(opts)
+	if err != nil {
+		return nil, err
+	}
+	compressed, err := blockgz.IsBlockGzip(path)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if compressed {
+		gz, err := blockgz.NewReader(f)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	report := &Report{
+		Path:       path,
+		Compressed: compressed,
+		Counts:     map[Kind]int{},
+		Issues:     []Issue{},
+	}
+	scanner := bufio.NewScanner(r)
+	scanner.Split(ScanRawLines)
+	for scanner.Scan() {
+		raw := scanner.Bytes()
+		for _, issue := range checker.Check(raw, report.Bytes) {
+			report.Counts[issue.Kind]++
+			if opts.MaxIssues > 0 && len(report.Issues) >= opts.MaxIssues {
+				report.Truncated = true
+				continue
+			}
+			report.Issues = append(report.Issues, issue)
+		}
+		report.Bytes += int64(len(raw) + 1)
+		report.Lines++
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%s line %d: %w", path, report.Lines+1, err)
+	}
+	// the last line may have no newline
+	if info, err := f.Stat(); err == nil && !compressed {
+		report.Bytes = min(report.Bytes, info.Size())
+	}
+	report.Sorted = report.Counts[OutOfOrder] == 0
+	return report, nil
+}
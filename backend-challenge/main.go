@@ -15,29 +15,69 @@ import (
 	"github.com/dekanayake/kart-challenge/backend-challenge/internal/reader"
 	"github.com/dekanayake/kart-challenge/backend-challenge/internal/repository"
 	"github.com/dekanayake/kart-challenge/backend-challenge/internal/routes"
+	"github.com/dekanayake/kart-challenge/backend-challenge/internal/tracing"
 )
 
 func main() {
-	config.LoadConfig()
-	config.InitLogger()
+	opts, err := config.LoadConfig(os.Args[1:])
+	if config.IsHelp(err) {
+		os.Exit(0)
+	}
+	if opts.PrintConfig {
+		if printErr := config.PrintConfig(os.Stdout, config.AppConfig); printErr != nil {
+			fmt.Fprintf(os.Stderr, "Failed to print configuration: %v\n", printErr)
+			os.Exit(1)
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid configuration:\n%v\n", err)
+		os.Exit(2)
+	}
+	if opts.PrintConfig {
+		os.Exit(0)
+	}
+
+	if err := config.InitLogger(); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to initialise logger: %v\n", err)
+		os.Exit(1)
+	}
 
 	config.Logger.Info().
-		Interface("config", config.AppConfig).
-		Msg("Loaded environment configuration")
+		Str("configFile", opts.ConfigFile).
+		Interface("config", config.AppConfig.Redacted()).
+		Msg("Loaded configuration")
 
-	port := fmt.Sprintf(":%d", config.AppConfig.Port)
+	shutdownTracing, err := tracing.Init(context.Background())
+	if err != nil {
+		config.Logger.Fatal().Err(err).Msg("Failed in initialising tracing.")
+	}
+
+	port := fmt.Sprintf(":%d", config.AppConfig.Server.Port)
 	config.Logger.Info().Msgf("Starting backend-challenge service on %s...", port)
 
 	productRepo := repository.GetProductRepository()
 	orderRepo := repository.GetOrderRepository()
-	fileReader, err := reader.GetFileReader("hdd", config.AppConfig.CouponCodeFolderPath, config.AppConfig.CouponCodeFilePartialIndexChunkSize, config.AppConfig.CouponCodeFileConcurrentPoolSize)
+	cartRepo, err := repository.GetCartRepository()
+	if err != nil {
+		config.Logger.Fatal().Err(err).Msg("Failed in creating the cart repository.")
+	}
+	readerOptions, err := reader.ConfigOptions(config.AppConfig.Coupon)
 	if err != nil {
+		config.Logger.Fatal().Err(err).Msg("Failed in creating the coupon policy.")
+	}
+	fileReader, err := reader.GetFileReader(config.AppConfig.Coupon.ReaderType, readerOptions)
+	if err != nil {
+		// keep serving products and carts, coupon lookups fail with 503 and readiness reports the error
 		config.Logger.Error().Err(err).Msg("Failed in creating the File reader.")
+		fileReader = reader.NewUnavailableFileReader(err)
+	} else if config.AppConfig.Coupon.Cache.Enabled {
+		fileReader = reader.NewCachingFileReader(fileReader, reader.ConfigCacheOptions(config.AppConfig.Coupon.Cache))
 	}
 
 	server := internal.Server{
 		ProductRepo: &productRepo,
 		OrderRepo:   &orderRepo,
+		CartRepo:    &cartRepo,
 		FileReader:  &fileReader,
 	}
 
@@ -49,7 +89,7 @@ func main() {
 
 	go func() {
 		config.Logger.Info().
-			Str("port", strconv.Itoa(config.AppConfig.Port)).
+			Str("port", strconv.Itoa(config.AppConfig.Server.Port)).
 			Msg("Server started successfully and listening for requests")
 
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
@@ -72,4 +112,8 @@ func main() {
 		config.Logger.Info().Msg("Server shut down gracefully")
 	}
 
+	if err := shutdownTracing(ctx); err != nil {
+		config.Logger.Error().Err(err).Msg("Failed to flush traces")
+	}
+
 }